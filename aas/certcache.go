@@ -0,0 +1,206 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package aas
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultJWTCertRefreshInterval is the RefreshInterval used when none is set
+	DefaultJWTCertRefreshInterval = time.Hour
+	// DefaultJWTCertOverlapWindow is the OverlapWindow used when none is set
+	DefaultJWTCertOverlapWindow = 24 * time.Hour
+	// DefaultJWTCertMinRefreshInterval is the MinRefreshInterval used when none is set
+	DefaultJWTCertMinRefreshInterval = time.Minute
+)
+
+// JWTCertCache verifies AAS tokens like JWTVerifier while keeping the JWT signing
+// certificates up to date across key rotations of AAS. The certificates are fetched again
+// every RefreshInterval, and immediately when a token signed with an unknown key is
+// presented, but not more often than every MinRefreshInterval. Certificates no longer
+// returned by AAS are still accepted for OverlapWindow, so that tokens issued before a
+// rotation stay valid.
+//
+// Issuer and Leeway are applied as in JWTVerifier. OnRefreshError, when set, is called
+// when fetching the certificates fails in the background.
+type JWTCertCache struct {
+	Issuer             string
+	Leeway             time.Duration
+	RefreshInterval    time.Duration
+	OverlapWindow      time.Duration
+	MinRefreshInterval time.Duration
+	OnRefreshError     func(err error)
+
+	jwt        JWTTokenProvider
+	rootCAsPEM []byte
+
+	refreshMu sync.Mutex
+	mu        sync.RWMutex
+	certs     map[string]*cachedCert
+	lastFetch time.Time
+}
+
+// cachedCert is a JWT signing certificate along with the last time AAS returned it
+type cachedCert struct {
+	cert     *x509.Certificate
+	lastSeen time.Time
+}
+
+// NewJWTCertCache returns a cache of the JWT signing certificates of AAS which have to chain
+// to one of the root CAs in rootCAsPEM. The certificates are fetched right away.
+func NewJWTCertCache(jwt JWTTokenProvider, rootCAsPEM []byte) (*JWTCertCache, error) {
+
+	c := JWTCertCache{
+		jwt:        jwt,
+		rootCAsPEM: rootCAsPEM,
+		certs:      make(map[string]*cachedCert),
+	}
+	if err := c.Refresh(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (c *JWTCertCache) refreshInterval() time.Duration {
+	if c.RefreshInterval == 0 {
+		return DefaultJWTCertRefreshInterval
+	}
+	return c.RefreshInterval
+}
+
+func (c *JWTCertCache) overlapWindow() time.Duration {
+	if c.OverlapWindow == 0 {
+		return DefaultJWTCertOverlapWindow
+	}
+	return c.OverlapWindow
+}
+
+func (c *JWTCertCache) minRefreshInterval() time.Duration {
+	if c.MinRefreshInterval == 0 {
+		return DefaultJWTCertMinRefreshInterval
+	}
+	return c.MinRefreshInterval
+}
+
+// Refresh fetches the JWT signing certificates from AAS. Certificates not returned anymore
+// are dropped once they have not been seen for OverlapWindow, or when they expire.
+func (c *JWTCertCache) Refresh() error {
+
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	return c.refresh()
+}
+
+func (c *JWTCertCache) refresh() error {
+
+	c.mu.Lock()
+	c.lastFetch = time.Now()
+	c.mu.Unlock()
+
+	v, err := FetchJWTVerifier(c.jwt, c.rootCAsPEM)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for kid, cert := range v.certs {
+		c.certs[kid] = &cachedCert{cert: cert, lastSeen: now}
+	}
+	for kid, cached := range c.certs {
+		if now.Sub(cached.lastSeen) > c.overlapWindow() || now.After(cached.cert.NotAfter) {
+			delete(c.certs, kid)
+		}
+	}
+	return nil
+}
+
+// refreshForUnknownKey fetches the certificates after a token with an unknown key was
+// presented, unless they have been fetched within MinRefreshInterval. It reports whether
+// the certificates were fetched.
+func (c *JWTCertCache) refreshForUnknownKey() bool {
+
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	c.mu.RLock()
+	recent := time.Since(c.lastFetch) < c.minRefreshInterval()
+	c.mu.RUnlock()
+	if recent {
+		return false
+	}
+	if err := c.refresh(); err != nil {
+		if c.OnRefreshError != nil {
+			c.OnRefreshError(err)
+		}
+		return false
+	}
+	return true
+}
+
+// Start refreshes the certificates every RefreshInterval in the background until ctx is done
+func (c *JWTCertCache) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(c.refreshInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := c.Refresh(); err != nil && c.OnRefreshError != nil {
+					c.OnRefreshError(err)
+				}
+			}
+		}
+	}()
+}
+
+func (c *JWTCertCache) verifier() *JWTVerifier {
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	v := JWTVerifier{
+		Issuer: c.Issuer,
+		Leeway: c.Leeway,
+		certs:  make(map[string]*x509.Certificate, len(c.certs)),
+	}
+	for kid, cached := range c.certs {
+		v.certs[kid] = cached.cert
+	}
+	return &v
+}
+
+// KeyIDs returns the key IDs of the cached signing certificates
+func (c *JWTCertCache) KeyIDs() []string {
+	return c.verifier().KeyIDs()
+}
+
+// Verify verifies token like JWTVerifier.Verify, fetching the certificates again when the
+// token is signed with an unknown key
+func (c *JWTCertCache) Verify(token []byte, claims interface{}) (*StandardClaims, error) {
+
+	sc, err := c.verifier().Verify(token, claims)
+	if !errors.Is(err, ErrTokenUnknownKeyID) || !c.refreshForUnknownKey() {
+		return sc, err
+	}
+	return c.verifier().Verify(token, claims)
+}
+
+// VerifyClaims verifies token like Verify and returns its claims
+func (c *JWTCertCache) VerifyClaims(token []byte) (*Claims, error) {
+
+	var claims Claims
+	if _, err := c.Verify(token, &claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
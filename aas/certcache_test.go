@@ -0,0 +1,97 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package aas
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingCertProvider counts the requests for the JWT signing certificates
+type countingCertProvider struct {
+	*FakeJWTTokenProvider
+	fetches int32
+}
+
+func (p *countingCertProvider) GetJWTSigningCert() ([]byte, error) {
+	atomic.AddInt32(&p.fetches, 1)
+	return p.FakeJWTTokenProvider.GetJWTSigningCert()
+}
+
+func TestJWTCertCacheRotation(t *testing.T) {
+
+	pki := newTestPKI(t)
+	provider := &countingCertProvider{FakeJWTTokenProvider: NewFakeJWTTokenProvider()}
+	provider.SigningCert = pki.signingPEM
+
+	cache, err := NewJWTCertCache(provider, pki.rootCAPEM)
+	assert.NoError(t, err, "cache should be created")
+	var _ TokenVerifier = cache
+	cache.MinRefreshInterval = time.Hour
+	oldToken := pki.signToken(t, "RS384", validTestClaims())
+	_, err = cache.VerifyClaims(oldToken)
+	assert.NoError(t, err, "token should be verified")
+
+	pki.rotateSigningCert(t)
+	provider.SigningCert = pki.signingPEM
+	newToken := pki.signToken(t, "RS384", validTestClaims())
+	_, err = cache.VerifyClaims(newToken)
+	assert.True(t, errors.Is(err, ErrTokenUnknownKeyID), "refresh should be rate limited")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&provider.fetches))
+
+	cache.MinRefreshInterval = time.Nanosecond
+	claims, err := cache.VerifyClaims(newToken)
+	assert.NoError(t, err, "token of the new signing certificate should be verified after refresh")
+	assert.Equal(t, "admin", claims.Subject)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&provider.fetches))
+	_, err = cache.VerifyClaims(oldToken)
+	assert.NoError(t, err, "token of the old signing certificate should be accepted within the overlap window")
+	assert.Len(t, cache.KeyIDs(), 2)
+
+	cache.OverlapWindow = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	assert.NoError(t, cache.Refresh())
+	assert.Equal(t, []string{KeyID(pki.signCert)}, cache.KeyIDs(), "old signing certificate should be dropped")
+	_, err = cache.VerifyClaims(oldToken)
+	assert.True(t, errors.Is(err, ErrTokenUnknownKeyID), "token of the old signing certificate should be rejected")
+}
+
+func TestJWTCertCacheRefreshError(t *testing.T) {
+
+	pki := newTestPKI(t)
+	provider := NewFakeJWTTokenProvider()
+	_, err := NewJWTCertCache(provider, pki.rootCAPEM)
+	assert.Error(t, err, "cache creation should fail without signing certificate")
+
+	provider.SigningCert = pki.signingPEM
+	cache, err := NewJWTCertCache(provider, pki.rootCAPEM)
+	assert.NoError(t, err, "cache should be created")
+
+	provider.SigningCert = nil
+	refreshErrs := make(chan error, 1)
+	cache.RefreshInterval = 10 * time.Millisecond
+	cache.OnRefreshError = func(err error) {
+		select {
+		case refreshErrs <- err:
+		default:
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cache.Start(ctx)
+	select {
+	case err := <-refreshErrs:
+		assert.Error(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("refresh error should be reported")
+	}
+	_, err = cache.VerifyClaims(pki.signToken(t, "RS384", validTestClaims()))
+	assert.NoError(t, err, "cached signing certificate should be kept when refresh fails")
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package aas
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	types "intel/isecl/lib/common/v5/types/aas"
+)
+
+// Claims are the claims of the tokens issued by AAS: the registered claims along with the
+// roles and permissions of the subject
+type Claims struct {
+	StandardClaims
+	types.AuthClaims
+}
+
+// ParseClaims returns the claims of token without verifying it. It is meant for inspecting
+// tokens obtained from AAS by the process itself, tokens received from others have to be
+// checked with JWTVerifier.VerifyClaims instead.
+func ParseClaims(token []byte) (*Claims, error) {
+
+	_, payload, _, _, err := splitToken(token)
+	if err != nil {
+		return nil, err
+	}
+	var claims Claims
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrMalformedToken
+	}
+	return &claims, nil
+}
+
+// VerifyClaims verifies token like Verify and returns its claims
+func (v *JWTVerifier) VerifyClaims(token []byte) (*Claims, error) {
+
+	var claims Claims
+	if _, err := v.Verify(token, &claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// Expired reports whether the token the claims belong to is expired
+func (c *Claims) Expired() bool {
+	return c.ExpiresAt != 0 && time.Now().After(c.ExpiryTime())
+}
+
+// HasRole reports whether the subject has the role name of service, in any context
+func (c *Claims) HasRole(service, name string) bool {
+	for _, r := range c.Roles {
+		if r.Service == service && r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleContexts returns the contexts of the roles name of service the subject has. An empty
+// context in the result means the role is not restricted to a context.
+func (c *Claims) RoleContexts(service, name string) []string {
+	var contexts []string
+	for _, r := range c.Roles {
+		if r.Service == service && r.Name == name {
+			contexts = append(contexts, strings.TrimSpace(r.Context))
+		}
+	}
+	return contexts
+}
+
+// HasPermission reports whether the subject is granted permission, in the form
+// "resource:action:selector", on service. The same wildcard semantics as in AAS apply:
+// a rule grants the permission when its resource and action are either "*" or equal
+// to the ones of the permission, and its selector is either "*", missing or equal to the
+// one of the permission.
+func (c *Claims) HasPermission(service, permission string) bool {
+	for _, p := range c.Permissions {
+		if p.Service != service {
+			continue
+		}
+		for _, rule := range p.Rules {
+			if ruleGrants(rule, permission) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func ruleGrants(rule, permission string) bool {
+
+	ruleParts := strings.Split(rule, ":")
+	permParts := strings.Split(permission, ":")
+	if len(ruleParts) < 2 || len(ruleParts) > 3 || len(permParts) < 2 || len(permParts) > 3 {
+		return false
+	}
+	for i := 0; i < 2; i++ {
+		if ruleParts[i] != "*" && ruleParts[i] != permParts[i] {
+			return false
+		}
+	}
+	if len(ruleParts) == 2 || ruleParts[2] == "*" {
+		return true
+	}
+	return len(permParts) == 3 && ruleParts[2] == permParts[2]
+}
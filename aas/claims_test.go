@@ -0,0 +1,64 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package aas
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	types "intel/isecl/lib/common/v5/types/aas"
+)
+
+func TestParseClaims(t *testing.T) {
+
+	claims, err := ParseClaims([]byte(aasToken))
+	assert.NoError(t, err, "claims should be parsed")
+	assert.Equal(t, "admin", claims.Subject)
+	assert.Equal(t, "AAS JWT Issuer", claims.Issuer)
+	assert.Equal(t, int64(1606285004), claims.ExpiresAt)
+	assert.True(t, claims.Expired())
+
+	assert.True(t, claims.HasRole("AAS", "RoleManager"))
+	assert.True(t, claims.HasRole("KMS", "KeyCRUD"))
+	assert.False(t, claims.HasRole("KMS", "Administrator"))
+	assert.False(t, claims.HasRole("CMS", "RoleManager"))
+
+	assert.True(t, claims.HasPermission("VS", "flavors:create:*"))
+	assert.True(t, claims.HasPermission("WLS", "images:retrieve"))
+	assert.False(t, claims.HasPermission("AAS", "users:create:*"), "AAS permissions are not part of the token")
+
+	_, err = ParseClaims([]byte("not.a-token"))
+	assert.Error(t, err, "malformed token should be rejected")
+}
+
+func TestClaimsHasPermission(t *testing.T) {
+
+	claims := Claims{
+		AuthClaims: types.AuthClaims{
+			Roles: []types.RoleInfo{
+				{Service: "CMS", Name: "CertApprover", Context: "CN=WLS TLS Certificate;SAN=wls.example.com;CERTTYPE=TLS"},
+				{Service: "CMS", Name: "CertApprover", Context: "CN=TA TLS Certificate;SAN=ta.example.com;CERTTYPE=TLS"},
+			},
+			Permissions: []types.PermissionInfo{
+				{Service: "VS", Rules: []string{"flavors:create:*", "hosts:*:*", "reports:search"}},
+				{Service: "KBS", Rules: []string{"keys:transfer:0aa1c0c5-5b5c-4d8a-9c0f-7a0d8e1b3f10"}},
+			},
+		},
+	}
+
+	assert.Len(t, claims.RoleContexts("CMS", "CertApprover"), 2)
+
+	assert.True(t, claims.HasPermission("VS", "flavors:create:*"))
+	assert.True(t, claims.HasPermission("VS", "flavors:create:0aa1c0c5"))
+	assert.False(t, claims.HasPermission("VS", "flavors:delete:*"))
+	assert.True(t, claims.HasPermission("VS", "hosts:delete:*"))
+	assert.True(t, claims.HasPermission("VS", "reports:search:*"))
+	assert.False(t, claims.HasPermission("TA", "hosts:delete:*"), "permissions of other services should not be granted")
+
+	assert.True(t, claims.HasPermission("KBS", "keys:transfer:0aa1c0c5-5b5c-4d8a-9c0f-7a0d8e1b3f10"))
+	assert.False(t, claims.HasPermission("KBS", "keys:transfer:*"), "selector restricted rule should not grant all selectors")
+	assert.False(t, claims.HasPermission("KBS", "keys:transfer"))
+	assert.False(t, claims.HasPermission("KBS", "keys"), "malformed permission should not be granted")
+}
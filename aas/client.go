@@ -6,6 +6,7 @@ package aas
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"intel/isecl/lib/clients/v5"
@@ -17,10 +18,21 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// Client is the client of the AAS users and roles API. Requests are authenticated with the
+// token of TokenSource, or with JWTToken when no TokenSource is set.
 type Client struct {
-	BaseURL    string
-	JWTToken   []byte
-	HTTPClient *http.Client
+	BaseURL     string
+	JWTToken    []byte
+	HTTPClient  *http.Client
+	TokenSource clients.TokenSource
+}
+
+// CustomClaims is the request for a custom claims token, the claims are added to
+// the token issued for subject which is valid for ValiditySecs seconds
+type CustomClaims struct {
+	Subject      string                 `json:"subject"`
+	ValiditySecs int                    `json:"validity_seconds"`
+	Claims       map[string]interface{} `json:"claims"`
 }
 
 var (
@@ -42,15 +54,57 @@ var (
 	ErrHTTPGetRoles = &clients.HTTPClientErr{
 		ErrMessage: "Failed to get roles",
 	}
+	ErrHTTPGetUser = &clients.HTTPClientErr{
+		ErrMessage: "Failed to get user by ID",
+	}
+	ErrHTTPDeleteUser = &clients.HTTPClientErr{
+		ErrMessage: "Failed to delete user",
+	}
+	ErrHTTPChangePassword = &clients.HTTPClientErr{
+		ErrMessage: "Failed to change user password",
+	}
+	ErrHTTPGetRole = &clients.HTTPClientErr{
+		ErrMessage: "Failed to get role by ID",
+	}
+	ErrHTTPDeleteRole = &clients.HTTPClientErr{
+		ErrMessage: "Failed to delete role",
+	}
+	ErrHTTPGetUserRoles = &clients.HTTPClientErr{
+		ErrMessage: "Failed to get roles of user",
+	}
+	ErrHTTPDeleteRoleFromUser = &clients.HTTPClientErr{
+		ErrMessage: "Failed to delete role from user",
+	}
+	ErrHTTPGetUserPermissions = &clients.HTTPClientErr{
+		ErrMessage: "Failed to get permissions of user",
+	}
+	ErrHTTPGetCustomClaimsToken = &clients.HTTPClientErr{
+		ErrMessage: "Failed to retrieve custom claims token from aas",
+	}
 )
 
 func (c *Client) prepReqHeader(req *http.Request) {
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Add("Authorization", "Bearer "+string(c.JWTToken))
+}
+
+func (c *Client) tokenSource() clients.TokenSource {
+	if c.TokenSource != nil {
+		return c.TokenSource
+	}
+	return clients.StaticTokenSource(c.JWTToken)
+}
+
+// do sends the request authenticated with the token of the client
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	return clients.DoWithToken(c.HTTPClient, req, c.tokenSource())
 }
 
 func (c *Client) CreateUser(u types.UserCreate) (*types.UserCreateResponse, error) {
+	return c.CreateUserWithContext(context.Background(), u)
+}
+
+func (c *Client) CreateUserWithContext(ctx context.Context, u types.UserCreate) (*types.UserCreateResponse, error) {
 
 	userURL := clients.ResolvePath(c.BaseURL, "users")
 
@@ -58,7 +112,7 @@ func (c *Client) CreateUser(u types.UserCreate) (*types.UserCreateResponse, erro
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest(http.MethodPost, userURL, bytes.NewBuffer(payload))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, userURL, bytes.NewBuffer(payload))
 	if err != nil {
 		return nil, err
 	}
@@ -67,13 +121,12 @@ func (c *Client) CreateUser(u types.UserCreate) (*types.UserCreateResponse, erro
 	if c.HTTPClient == nil {
 		return nil, errors.New("aasClient.CreateUser: HTTPClient should not be null")
 	}
-	rsp, err := c.HTTPClient.Do(req)
+	rsp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
 	if rsp.StatusCode != http.StatusCreated {
-		ErrHTTPCreateUser.RetCode = rsp.StatusCode
-		return nil, ErrHTTPCreateUser
+		return nil, clients.NewHTTPClientErr(ErrHTTPCreateUser, rsp)
 	}
 	var userCreateResponse types.UserCreateResponse
 	err = json.NewDecoder(rsp.Body).Decode(&userCreateResponse)
@@ -84,6 +137,10 @@ func (c *Client) CreateUser(u types.UserCreate) (*types.UserCreateResponse, erro
 }
 
 func (c *Client) GetUsers(name string) ([]types.UserCreateResponse, error) {
+	return c.GetUsersWithContext(context.Background(), name)
+}
+
+func (c *Client) GetUsersWithContext(ctx context.Context, name string) ([]types.UserCreateResponse, error) {
 
 	relativeUrl := "users"
 	u, _ := url.Parse(relativeUrl)
@@ -96,7 +153,7 @@ func (c *Client) GetUsers(name string) ([]types.UserCreateResponse, error) {
 
 	userURL := clients.ResolvePath(c.BaseURL, u.ResolveReference(u).String())
 
-	req, err := http.NewRequest(http.MethodGet, userURL, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, userURL, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -105,13 +162,12 @@ func (c *Client) GetUsers(name string) ([]types.UserCreateResponse, error) {
 	if c.HTTPClient == nil {
 		return nil, errors.New("aasClient.GetUsers: HTTPClient should not be null")
 	}
-	rsp, err := c.HTTPClient.Do(req)
+	rsp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
 	if rsp.StatusCode != http.StatusOK {
-		ErrHTTPGetUsers.RetCode = rsp.StatusCode
-		return nil, ErrHTTPGetUsers
+		return nil, clients.NewHTTPClientErr(ErrHTTPGetUsers, rsp)
 	}
 	var users []types.UserCreateResponse
 	err = json.NewDecoder(rsp.Body).Decode(&users)
@@ -121,7 +177,106 @@ func (c *Client) GetUsers(name string) ([]types.UserCreateResponse, error) {
 	return users, nil
 }
 
+func (c *Client) GetUser(userID string) (*types.UserCreateResponse, error) {
+	return c.GetUserWithContext(context.Background(), userID)
+}
+
+func (c *Client) GetUserWithContext(ctx context.Context, userID string) (*types.UserCreateResponse, error) {
+
+	userURL := clients.ResolvePath(c.BaseURL, "users/"+userID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, userURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.prepReqHeader(req)
+
+	if c.HTTPClient == nil {
+		return nil, errors.New("aasClient.GetUser: HTTPClient should not be null")
+	}
+	rsp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return nil, clients.NewHTTPClientErr(ErrHTTPGetUser, rsp)
+	}
+	var user types.UserCreateResponse
+	err = json.NewDecoder(rsp.Body).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (c *Client) DeleteUser(userID string) error {
+	return c.DeleteUserWithContext(context.Background(), userID)
+}
+
+func (c *Client) DeleteUserWithContext(ctx context.Context, userID string) error {
+
+	userURL := clients.ResolvePath(c.BaseURL, "users/"+userID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, userURL, nil)
+	if err != nil {
+		return err
+	}
+	c.prepReqHeader(req)
+
+	if c.HTTPClient == nil {
+		return errors.New("aasClient.DeleteUser: HTTPClient should not be null")
+	}
+	rsp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusNoContent {
+		return clients.NewHTTPClientErr(ErrHTTPDeleteUser, rsp)
+	}
+	return nil
+}
+
+// ChangePassword changes the password of the user named in pc, the old password
+// has to be provided along with the new one
+func (c *Client) ChangePassword(pc types.PasswordChange) error {
+	return c.ChangePasswordWithContext(context.Background(), pc)
+}
+
+func (c *Client) ChangePasswordWithContext(ctx context.Context, pc types.PasswordChange) error {
+
+	changePasswordURL := clients.ResolvePath(c.BaseURL, "users/changepassword")
+
+	payload, err := json.Marshal(&pc)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, changePasswordURL, bytes.NewBuffer(payload))
+	if err != nil {
+		return err
+	}
+	c.prepReqHeader(req)
+
+	if c.HTTPClient == nil {
+		return errors.New("aasClient.ChangePassword: HTTPClient should not be null")
+	}
+	rsp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return clients.NewHTTPClientErr(ErrHTTPChangePassword, rsp)
+	}
+	return nil
+}
+
 func (c *Client) CreateRole(r types.RoleCreate) (*types.RoleCreateResponse, error) {
+	return c.CreateRoleWithContext(context.Background(), r)
+}
+
+func (c *Client) CreateRoleWithContext(ctx context.Context, r types.RoleCreate) (*types.RoleCreateResponse, error) {
 
 	roleURL := clients.ResolvePath(c.BaseURL, "roles")
 
@@ -129,7 +284,7 @@ func (c *Client) CreateRole(r types.RoleCreate) (*types.RoleCreateResponse, erro
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest(http.MethodPost, roleURL, bytes.NewBuffer(payload))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, roleURL, bytes.NewBuffer(payload))
 	if err != nil {
 		return nil, err
 	}
@@ -138,16 +293,19 @@ func (c *Client) CreateRole(r types.RoleCreate) (*types.RoleCreateResponse, erro
 	if c.HTTPClient == nil {
 		return nil, errors.New("aasClient.CreateRole: HTTPClient should not be null")
 	}
-	rsp, err := c.HTTPClient.Do(req)
+	rsp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
-	msg, _ := ioutil.ReadAll(rsp.Body)
+	defer rsp.Body.Close()
 	if rsp.StatusCode != http.StatusCreated {
-		ErrHTTPCreateRole.RetCode = rsp.StatusCode
-		ErrHTTPCreateRole.RetMessage = string(msg)
-		log.Errorf("Role not created. http errorcode : %d, message: %s", ErrHTTPCreateRole.RetCode, ErrHTTPCreateRole.RetMessage)
-		return nil, ErrHTTPCreateRole
+		httpErr := clients.NewHTTPClientErr(ErrHTTPCreateRole, rsp)
+		log.Errorf("Role not created. http errorcode : %d, message: %s", httpErr.RetCode, httpErr.RetMessage)
+		return nil, httpErr
+	}
+	msg, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
 	}
 	var roleCreateResponse types.RoleCreateResponse
 	err = json.Unmarshal(msg, &roleCreateResponse)
@@ -158,7 +316,11 @@ func (c *Client) CreateRole(r types.RoleCreate) (*types.RoleCreateResponse, erro
 	return &roleCreateResponse, nil
 }
 
-func (c *Client) GetRoles(service, name, context, contextContains string, allContexts bool) ([]types.RoleCreateResponse, error) {
+func (c *Client) GetRoles(service, name, roleContext, contextContains string, allContexts bool) ([]types.RoleCreateResponse, error) {
+	return c.GetRolesWithContext(context.Background(), service, name, roleContext, contextContains, allContexts)
+}
+
+func (c *Client) GetRolesWithContext(ctx context.Context, service, name, roleContext, contextContains string, allContexts bool) ([]types.RoleCreateResponse, error) {
 
 	relativeUrl := "roles"
 	u, _ := url.Parse(relativeUrl)
@@ -169,8 +331,8 @@ func (c *Client) GetRoles(service, name, context, contextContains string, allCon
 	if name != "" {
 		queryString.Set("name", name)
 	}
-	if context != "" {
-		queryString.Set("context", context)
+	if roleContext != "" {
+		queryString.Set("context", roleContext)
 	}
 	if contextContains != "" {
 		queryString.Set("contextContains", contextContains)
@@ -185,7 +347,7 @@ func (c *Client) GetRoles(service, name, context, contextContains string, allCon
 
 	rolesURL := clients.ResolvePath(c.BaseURL, u.ResolveReference(u).String())
 
-	req, err := http.NewRequest(http.MethodGet, rolesURL, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rolesURL, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -194,13 +356,106 @@ func (c *Client) GetRoles(service, name, context, contextContains string, allCon
 	if c.HTTPClient == nil {
 		return nil, errors.New("aasClient.GetRoles: HTTPClient should not be null")
 	}
-	rsp, err := c.HTTPClient.Do(req)
+	rsp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return nil, clients.NewHTTPClientErr(ErrHTTPGetRoles, rsp)
+	}
+	var roles []types.RoleCreateResponse
+	err = json.NewDecoder(rsp.Body).Decode(&roles)
+	if err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (c *Client) GetRole(roleID string) (*types.RoleCreateResponse, error) {
+	return c.GetRoleWithContext(context.Background(), roleID)
+}
+
+func (c *Client) GetRoleWithContext(ctx context.Context, roleID string) (*types.RoleCreateResponse, error) {
+
+	roleURL := clients.ResolvePath(c.BaseURL, "roles/"+roleID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, roleURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.prepReqHeader(req)
+
+	if c.HTTPClient == nil {
+		return nil, errors.New("aasClient.GetRole: HTTPClient should not be null")
+	}
+	rsp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return nil, clients.NewHTTPClientErr(ErrHTTPGetRole, rsp)
+	}
+	var role types.RoleCreateResponse
+	err = json.NewDecoder(rsp.Body).Decode(&role)
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (c *Client) DeleteRole(roleID string) error {
+	return c.DeleteRoleWithContext(context.Background(), roleID)
+}
+
+func (c *Client) DeleteRoleWithContext(ctx context.Context, roleID string) error {
+
+	roleURL := clients.ResolvePath(c.BaseURL, "roles/"+roleID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, roleURL, nil)
+	if err != nil {
+		return err
+	}
+	c.prepReqHeader(req)
+
+	if c.HTTPClient == nil {
+		return errors.New("aasClient.DeleteRole: HTTPClient should not be null")
+	}
+	rsp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusNoContent {
+		return clients.NewHTTPClientErr(ErrHTTPDeleteRole, rsp)
+	}
+	return nil
+}
+
+func (c *Client) GetRolesForUser(userID string) ([]types.RoleCreateResponse, error) {
+	return c.GetRolesForUserWithContext(context.Background(), userID)
+}
+
+func (c *Client) GetRolesForUserWithContext(ctx context.Context, userID string) ([]types.RoleCreateResponse, error) {
+
+	userRoleURL := clients.ResolvePath(c.BaseURL, "users/"+userID+"/roles")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, userRoleURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.prepReqHeader(req)
+
+	if c.HTTPClient == nil {
+		return nil, errors.New("aasClient.GetRolesForUser: HTTPClient should not be null")
+	}
+	rsp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
+	defer rsp.Body.Close()
 	if rsp.StatusCode != http.StatusOK {
-		ErrHTTPGetRoles.RetCode = rsp.StatusCode
-		return nil, ErrHTTPCreateUser
+		return nil, clients.NewHTTPClientErr(ErrHTTPGetUserRoles, rsp)
 	}
 	var roles []types.RoleCreateResponse
 	err = json.NewDecoder(rsp.Body).Decode(&roles)
@@ -210,7 +465,56 @@ func (c *Client) GetRoles(service, name, context, contextContains string, allCon
 	return roles, nil
 }
 
+// GetPermissionsForUser returns the effective permissions granted to the user through
+// all of its roles. Only the permissions of the given service are returned when service
+// is not empty.
+func (c *Client) GetPermissionsForUser(userID, service string) ([]types.PermissionInfo, error) {
+	return c.GetPermissionsForUserWithContext(context.Background(), userID, service)
+}
+
+func (c *Client) GetPermissionsForUserWithContext(ctx context.Context, userID, service string) ([]types.PermissionInfo, error) {
+
+	relativeUrl := "users/" + userID + "/permissions"
+	u, _ := url.Parse(relativeUrl)
+	queryString := u.Query()
+	if service != "" {
+		queryString.Set("service", service)
+	}
+
+	u.RawQuery = queryString.Encode()
+
+	permissionsURL := clients.ResolvePath(c.BaseURL, u.String())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, permissionsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.prepReqHeader(req)
+
+	if c.HTTPClient == nil {
+		return nil, errors.New("aasClient.GetPermissionsForUser: HTTPClient should not be null")
+	}
+	rsp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return nil, clients.NewHTTPClientErr(ErrHTTPGetUserPermissions, rsp)
+	}
+	var permissions []types.PermissionInfo
+	err = json.NewDecoder(rsp.Body).Decode(&permissions)
+	if err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
 func (c *Client) UpdateUser(userID string, user types.UserCreate) error {
+	return c.UpdateUserWithContext(context.Background(), userID, user)
+}
+
+func (c *Client) UpdateUserWithContext(ctx context.Context, userID string, user types.UserCreate) error {
 
 	userRoleURL := clients.ResolvePath(c.BaseURL, "users/"+userID)
 
@@ -218,7 +522,7 @@ func (c *Client) UpdateUser(userID string, user types.UserCreate) error {
 	if err != nil {
 		return err
 	}
-	req, err := http.NewRequest(http.MethodPatch, userRoleURL, bytes.NewBuffer(payload))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, userRoleURL, bytes.NewBuffer(payload))
 	if err != nil {
 		return err
 	}
@@ -227,15 +531,21 @@ func (c *Client) UpdateUser(userID string, user types.UserCreate) error {
 	if c.HTTPClient == nil {
 		return errors.New("aaClient.UpdateUser: HTTPClient should not be null")
 	}
-	rsp, err := c.HTTPClient.Do(req)
+	rsp, err := c.do(req)
+	if err != nil {
+		return err
+	}
 	if rsp.StatusCode != http.StatusOK {
-		ErrHTTPUpdateUser.RetCode = rsp.StatusCode
-		return ErrHTTPUpdateUser
+		return clients.NewHTTPClientErr(ErrHTTPUpdateUser, rsp)
 	}
 	return nil
 }
 
 func (c *Client) AddRoleToUser(userID string, r types.RoleIDs) error {
+	return c.AddRoleToUserWithContext(context.Background(), userID, r)
+}
+
+func (c *Client) AddRoleToUserWithContext(ctx context.Context, userID string, r types.RoleIDs) error {
 
 	userRoleURL := clients.ResolvePath(c.BaseURL, "users/"+userID+"/roles")
 
@@ -243,7 +553,7 @@ func (c *Client) AddRoleToUser(userID string, r types.RoleIDs) error {
 	if err != nil {
 		return err
 	}
-	req, err := http.NewRequest(http.MethodPost, userRoleURL, bytes.NewBuffer(payload))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, userRoleURL, bytes.NewBuffer(payload))
 	if err != nil {
 		return err
 	}
@@ -252,10 +562,76 @@ func (c *Client) AddRoleToUser(userID string, r types.RoleIDs) error {
 	if c.HTTPClient == nil {
 		return errors.New("aaClient.AddRoleToUser: HTTPClient should not be null")
 	}
-	rsp, err := c.HTTPClient.Do(req)
+	rsp, err := c.do(req)
+	if err != nil {
+		return err
+	}
 	if rsp.StatusCode != http.StatusCreated {
-		ErrHTTPAddRoleToUser.RetCode = rsp.StatusCode
-		return ErrHTTPAddRoleToUser
+		return clients.NewHTTPClientErr(ErrHTTPAddRoleToUser, rsp)
 	}
 	return nil
 }
+
+func (c *Client) DeleteRoleFromUser(userID, roleID string) error {
+	return c.DeleteRoleFromUserWithContext(context.Background(), userID, roleID)
+}
+
+func (c *Client) DeleteRoleFromUserWithContext(ctx context.Context, userID, roleID string) error {
+
+	userRoleURL := clients.ResolvePath(c.BaseURL, "users/"+userID+"/roles/"+roleID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, userRoleURL, nil)
+	if err != nil {
+		return err
+	}
+	c.prepReqHeader(req)
+
+	if c.HTTPClient == nil {
+		return errors.New("aasClient.DeleteRoleFromUser: HTTPClient should not be null")
+	}
+	rsp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusNoContent {
+		return clients.NewHTTPClientErr(ErrHTTPDeleteRoleFromUser, rsp)
+	}
+	return nil
+}
+
+// GetCustomClaimsToken requests AAS to issue a token carrying the given custom claims.
+// The request is authenticated with JWTToken, which needs the permission to create
+// custom claims tokens.
+func (c *Client) GetCustomClaimsToken(cc CustomClaims) ([]byte, error) {
+	return c.GetCustomClaimsTokenWithContext(context.Background(), cc)
+}
+
+func (c *Client) GetCustomClaimsTokenWithContext(ctx context.Context, cc CustomClaims) ([]byte, error) {
+
+	tokenURL := clients.ResolvePath(c.BaseURL, "custom-claims-token")
+
+	payload, err := json.Marshal(&cc)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, bytes.NewBuffer(payload))
+	if err != nil {
+		return nil, err
+	}
+	c.prepReqHeader(req)
+	req.Header.Set("Accept", "application/jwt")
+
+	if c.HTTPClient == nil {
+		return nil, errors.New("aasClient.GetCustomClaimsToken: HTTPClient should not be null")
+	}
+	rsp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return nil, clients.NewHTTPClientErr(ErrHTTPGetCustomClaimsToken, rsp)
+	}
+	return ioutil.ReadAll(rsp.Body)
+}
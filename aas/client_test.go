@@ -5,11 +5,15 @@
 package aas
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"testing"
 
+	"intel/isecl/lib/clients/v5"
 	types "intel/isecl/lib/common/v5/types/aas"
 )
 
@@ -52,3 +56,216 @@ func TestAASClient(t *testing.T) {
 	_, err = aasClient.CreateRole(role)
 	assert.NoError(t, err, "role should be created")
 }
+
+func TestAASClientUserLifecycle(t *testing.T) {
+
+	aasMockSrv, port := aasMockServer(t)
+	defer aasMockSrv.Close()
+
+	aasClient := Client{
+		BaseURL:    "http://localhost" + port + "/aas",
+		JWTToken:   []byte(aasToken),
+		HTTPClient: http.DefaultClient,
+	}
+
+	user, err := aasClient.GetUser(mockUserID)
+	assert.NoError(t, err, "user should be retrieved")
+	assert.Equal(t, mockUserID, user.ID)
+
+	_, err = aasClient.GetUser(uuid.New().String())
+	assert.Error(t, err, "unknown user should not be retrieved")
+
+	err = aasClient.ChangePassword(types.PasswordChange{
+		UserName:        "test_user",
+		OldPassword:     "password",
+		NewPassword:     "new_password",
+		PasswordConfirm: "new_password",
+	})
+	assert.NoError(t, err, "password should be changed")
+
+	err = aasClient.ChangePassword(types.PasswordChange{
+		UserName:        "test_user",
+		OldPassword:     "password",
+		NewPassword:     "new_password",
+		PasswordConfirm: "other_password",
+	})
+	assert.Error(t, err, "password change should fail when confirmation does not match")
+
+	err = aasClient.DeleteUser(mockUserID)
+	assert.NoError(t, err, "user should be deleted")
+
+	err = aasClient.DeleteUser(uuid.New().String())
+	assert.Error(t, err, "unknown user should not be deleted")
+}
+
+func TestAASClientRoleLifecycle(t *testing.T) {
+
+	aasMockSrv, port := aasMockServer(t)
+	defer aasMockSrv.Close()
+
+	aasClient := Client{
+		BaseURL:    "http://localhost" + port + "/aas",
+		JWTToken:   []byte(aasToken),
+		HTTPClient: http.DefaultClient,
+	}
+
+	role, err := aasClient.GetRole(mockRoleID)
+	assert.NoError(t, err, "role should be retrieved")
+	assert.Equal(t, mockRoleID, role.ID)
+
+	_, err = aasClient.GetRole(uuid.New().String())
+	assert.Error(t, err, "unknown role should not be retrieved")
+
+	roles, err := aasClient.GetRolesForUser(mockUserID)
+	assert.NoError(t, err, "roles of user should be retrieved")
+	assert.Len(t, roles, 1)
+
+	err = aasClient.DeleteRoleFromUser(mockUserID, mockRoleID)
+	assert.NoError(t, err, "role should be removed from user")
+
+	err = aasClient.DeleteRoleFromUser(mockUserID, uuid.New().String())
+	assert.Error(t, err, "unbound role should not be removed from user")
+
+	err = aasClient.DeleteRole(mockRoleID)
+	assert.NoError(t, err, "role should be deleted")
+
+	err = aasClient.DeleteRole(uuid.New().String())
+	assert.Error(t, err, "unknown role should not be deleted")
+}
+
+func TestAASClientGetPermissionsForUser(t *testing.T) {
+
+	aasMockSrv, port := aasMockServer(t)
+	defer aasMockSrv.Close()
+
+	aasClient := Client{
+		BaseURL:    "http://localhost" + port + "/aas",
+		JWTToken:   []byte(aasToken),
+		HTTPClient: http.DefaultClient,
+	}
+
+	permissions, err := aasClient.GetPermissionsForUser(mockUserID, "")
+	assert.NoError(t, err, "permissions of user should be retrieved")
+	assert.Len(t, permissions, 2)
+
+	permissions, err = aasClient.GetPermissionsForUser(mockUserID, "VS")
+	assert.NoError(t, err, "permissions of user should be retrieved for service")
+	assert.Len(t, permissions, 1)
+	assert.Equal(t, []string{"flavors:create:*", "flavors:search:*"}, permissions[0].Rules)
+
+	_, err = aasClient.GetPermissionsForUser(uuid.New().String(), "")
+	assert.Error(t, err, "permissions of unknown user should not be retrieved")
+}
+
+func TestAASClientGetCustomClaimsToken(t *testing.T) {
+
+	aasMockSrv, port := aasMockServer(t)
+	defer aasMockSrv.Close()
+
+	aasClient := Client{
+		BaseURL:    "http://localhost" + port + "/aas",
+		JWTToken:   []byte(aasToken),
+		HTTPClient: http.DefaultClient,
+	}
+
+	token, err := aasClient.GetCustomClaimsToken(CustomClaims{
+		Subject:      "00ecd3ab-9af4-4b8c-8e06-1df3e8b8e1b2",
+		ValiditySecs: 3600,
+		Claims: map[string]interface{}{
+			"hardware_uuid": "00ecd3ab-9af4-4b8c-8e06-1df3e8b8e1b2",
+		},
+	})
+	assert.NoError(t, err, "custom claims token should be issued")
+	assert.Equal(t, aasToken, string(token))
+
+	_, err = aasClient.GetCustomClaimsToken(CustomClaims{})
+	assert.Error(t, err, "custom claims token should not be issued without subject")
+
+	aasClient.JWTToken = nil
+	_, err = aasClient.GetCustomClaimsToken(CustomClaims{
+		Subject:      "00ecd3ab-9af4-4b8c-8e06-1df3e8b8e1b2",
+		ValiditySecs: 3600,
+	})
+	assert.Error(t, err, "custom claims token should not be issued without bearer token")
+}
+
+func TestAASClientWithContext(t *testing.T) {
+
+	aasMockSrv, port := aasMockServer(t)
+	defer aasMockSrv.Close()
+
+	aasClient := Client{
+		BaseURL:    "http://localhost" + port + "/aas",
+		JWTToken:   []byte(aasToken),
+		HTTPClient: http.DefaultClient,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	user, err := aasClient.GetUserWithContext(ctx, mockUserID)
+	assert.NoError(t, err, "user should be retrieved")
+	assert.Equal(t, mockUserID, user.ID)
+
+	cancel()
+	_, err = aasClient.GetUserWithContext(ctx, mockUserID)
+	assert.True(t, errors.Is(err, context.Canceled), "request should be canceled with its context")
+
+	jwt := NewJWTClient(aasClient.BaseURL)
+	jwt.HTTPClient = http.DefaultClient
+	jwt.AddUser("admin", "password")
+	_, err = jwt.FetchTokenForUserWithContext(ctx, "admin")
+	assert.True(t, errors.Is(err, context.Canceled), "token fetch should be canceled with its context")
+}
+
+func TestAASClientErrors(t *testing.T) {
+
+	aasMockSrv, port := aasMockServer(t)
+	defer aasMockSrv.Close()
+
+	aasClient := Client{
+		BaseURL:    "http://localhost" + port + "/aas",
+		JWTToken:   []byte(aasToken),
+		HTTPClient: http.DefaultClient,
+	}
+
+	_, err := aasClient.GetUser(uuid.New().String())
+	assert.True(t, errors.Is(err, ErrHTTPGetUser), "error should match its sentinel")
+	assert.False(t, errors.Is(err, ErrHTTPGetRole), "error should not match other sentinels")
+	var httpErr *clients.HTTPClientErr
+	assert.True(t, errors.As(err, &httpErr))
+	assert.Equal(t, http.StatusNotFound, httpErr.RetCode)
+	assert.Contains(t, httpErr.URL, "/aas/users/")
+	assert.Zero(t, ErrHTTPGetUser.RetCode, "sentinel should not be modified")
+
+	err = aasClient.ChangePassword(types.PasswordChange{NewPassword: "a", PasswordConfirm: "b"})
+	assert.True(t, errors.As(err, &httpErr))
+	assert.Equal(t, "Confirm password does not match", httpErr.RetMessage)
+
+	jwt := NewJWTClient(aasClient.BaseURL)
+	_, err = jwt.GetUserToken("unknown")
+	assert.True(t, errors.Is(err, ErrUserNotFound), "error should match its sentinel")
+	assert.Equal(t, "User name not registered: unknown", err.Error())
+	assert.Empty(t, ErrUserNotFound.ErrInfo, "sentinel should not be modified")
+}
+
+func TestAASClientTokenSource(t *testing.T) {
+
+	aasMockSrv, port := aasMockServer(t)
+	defer aasMockSrv.Close()
+
+	aasURL := "http://localhost" + port + "/aas"
+	jwt := NewJWTClient(aasURL)
+	jwt.HTTPClient = http.DefaultClient
+	jwt.AddUser("admin", "password")
+
+	aasClient := Client{
+		BaseURL:     aasURL,
+		JWTToken:    []byte("expired"),
+		HTTPClient:  http.DefaultClient,
+		TokenSource: NewJWTTokenSource(jwt, "admin"),
+	}
+	_, err := aasClient.GetCustomClaimsToken(CustomClaims{
+		Subject:      "00ecd3ab-9af4-4b8c-8e06-1df3e8b8e1b2",
+		ValiditySecs: 3600,
+	})
+	assert.NoError(t, err, "token should be fetched from the token source")
+}
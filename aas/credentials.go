@@ -0,0 +1,69 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package aas
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// CredentialSource supplies the password of a user registered with jwtClient. It is
+// consulted on every token fetch, so that rotated passwords are picked up without
+// registering the user again.
+type CredentialSource interface {
+	Password() (string, error)
+}
+
+type staticCredential string
+
+// StaticCredential returns a CredentialSource that always supplies password
+func StaticCredential(password string) CredentialSource {
+	return staticCredential(password)
+}
+
+func (s staticCredential) Password() (string, error) {
+	return string(s), nil
+}
+
+type envCredential string
+
+// EnvCredential returns a CredentialSource that reads the password from the environment
+// variable name
+func EnvCredential(name string) CredentialSource {
+	return envCredential(name)
+}
+
+func (s envCredential) Password() (string, error) {
+	password, ok := os.LookupEnv(string(s))
+	if !ok {
+		return "", errors.New("environment variable " + string(s) + " is not set")
+	}
+	return password, nil
+}
+
+type fileCredential string
+
+// FileCredential returns a CredentialSource that reads the password from the file path,
+// e.g. a Kubernetes secret mount. Leading and trailing white space is ignored.
+func FileCredential(path string) CredentialSource {
+	return fileCredential(path)
+}
+
+func (s fileCredential) Password() (string, error) {
+	password, err := ioutil.ReadFile(string(s))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(password)), nil
+}
+
+// CredentialFunc adapts a function to a CredentialSource
+type CredentialFunc func() (string, error)
+
+func (f CredentialFunc) Password() (string, error) {
+	return f()
+}
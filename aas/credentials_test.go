@@ -0,0 +1,85 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package aas
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	types "intel/isecl/lib/common/v5/types/aas"
+)
+
+func TestCredentialSources(t *testing.T) {
+
+	os.Setenv("AAS_TEST_PASSWORD", "env-password")
+	defer os.Unsetenv("AAS_TEST_PASSWORD")
+	password, err := EnvCredential("AAS_TEST_PASSWORD").Password()
+	assert.NoError(t, err)
+	assert.Equal(t, "env-password", password)
+	_, err = EnvCredential("AAS_TEST_PASSWORD_UNSET").Password()
+	assert.Error(t, err, "unset environment variable should be reported")
+
+	path := filepath.Join(t.TempDir(), "password")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("file-password\n"), 0600))
+	password, err = FileCredential(path).Password()
+	assert.NoError(t, err)
+	assert.Equal(t, "file-password", password, "trailing newline should be trimmed")
+	_, err = FileCredential(path + ".missing").Password()
+	assert.Error(t, err, "missing file should be reported")
+}
+
+func TestJWTUserCredentials(t *testing.T) {
+
+	passwords := make(chan string, 10)
+	handler := mux.NewRouter()
+	handler.HandleFunc("/aas/token", func(w http.ResponseWriter, r *http.Request) {
+		var cred types.UserCred
+		_ = json.NewDecoder(r.Body).Decode(&cred)
+		passwords <- cred.Password
+		tokenMockGoodResponse(w, r)
+	}).Methods("POST")
+	aasMockSrv, port := mockServerLauncher(t, handler)
+	defer aasMockSrv.Close()
+
+	jwt := NewJWTClient("http://localhost" + port + "/aas")
+	jwt.HTTPClient = http.DefaultClient
+
+	path := filepath.Join(t.TempDir(), "password")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("first"), 0600))
+	jwt.AddUserWithCredential("user1", FileCredential(path))
+	_, err := jwt.FetchTokenForUser("user1")
+	assert.NoError(t, err)
+	assert.Equal(t, "first", <-passwords)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("rotated"), 0600))
+	_, err = jwt.FetchTokenForUser("user1")
+	assert.NoError(t, err)
+	assert.Equal(t, "rotated", <-passwords, "rotated password should be picked up")
+
+	jwt.AddUserWithCredential("user2", CredentialFunc(func() (string, error) {
+		return "", errors.New("vault unavailable")
+	}))
+	_, err = jwt.FetchTokenForUser("user2")
+	assert.True(t, errors.Is(err, ErrUserCredential), "credential failure should be reported")
+
+	assert.NoError(t, jwt.UpdateUserPassword("user2", "updated"))
+	_, err = jwt.FetchTokenForUser("user2")
+	assert.NoError(t, err)
+	assert.Equal(t, "updated", <-passwords)
+	assert.True(t, errors.Is(jwt.UpdateUserPassword("user3", "password"), ErrUserNotFound))
+
+	jwt.RemoveUser("user1")
+	_, err = jwt.GetUserToken("user1")
+	assert.True(t, errors.Is(err, ErrUserNotFound), "removed user should be unknown")
+	_, err = jwt.GetUserToken("user2")
+	assert.NoError(t, err, "token of the other user should be kept")
+}
@@ -0,0 +1,236 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package aas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"intel/isecl/lib/clients/v5"
+	types "intel/isecl/lib/common/v5/types/aas"
+)
+
+// EnsureResult reports what an Ensure call had to do to converge to the desired state
+type EnsureResult int
+
+const (
+	// Unchanged means the desired state was already in place
+	Unchanged EnsureResult = iota
+	// Created means the user or role did not exist and was created
+	Created
+	// Changed means an existing object was modified, e.g. roles were bound to a user
+	Changed
+)
+
+func (r EnsureResult) String() string {
+	switch r {
+	case Created:
+		return "created"
+	case Changed:
+		return "changed"
+	default:
+		return "unchanged"
+	}
+}
+
+func (c *Client) findUser(ctx context.Context, name string) (*types.UserCreateResponse, error) {
+	users, err := c.GetUsersWithContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	for i := range users {
+		if users[i].Name == name {
+			return &users[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *Client) findRole(ctx context.Context, r types.RoleInfo) (*types.RoleCreateResponse, error) {
+	roles, err := c.GetRolesWithContext(ctx, r.Service, r.Name, r.Context, "", false)
+	if err != nil {
+		return nil, err
+	}
+	for i := range roles {
+		if roles[i].Service == r.Service && roles[i].Name == r.Name {
+			return &roles[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// EnsureUser creates the user if no user with the same name exists. The password of
+// an existing user is left untouched.
+func (c *Client) EnsureUser(u types.UserCreate) (*types.UserCreateResponse, EnsureResult, error) {
+	return c.EnsureUserWithContext(context.Background(), u)
+}
+
+func (c *Client) EnsureUserWithContext(ctx context.Context, u types.UserCreate) (*types.UserCreateResponse, EnsureResult, error) {
+
+	user, err := c.findUser(ctx, u.Name)
+	if err != nil {
+		return nil, Unchanged, err
+	}
+	if user != nil {
+		return user, Unchanged, nil
+	}
+	user, err = c.CreateUserWithContext(ctx, u)
+	if err == nil {
+		return user, Created, nil
+	}
+	if !clients.IsConflict(err) {
+		return nil, Unchanged, err
+	}
+	// created concurrently by someone else since the lookup
+	user, err = c.findUser(ctx, u.Name)
+	if err != nil {
+		return nil, Unchanged, err
+	}
+	if user == nil {
+		return nil, Unchanged, errors.New("aasClient.EnsureUser: user reported as existing but not found: " + u.Name)
+	}
+	return user, Unchanged, nil
+}
+
+// EnsureRole creates the role if no role with the same service, name and context exists.
+// AAS does not allow permissions of a role to be modified, so the permissions of an
+// existing role are not compared with the requested ones.
+func (c *Client) EnsureRole(r types.RoleCreate) (*types.RoleCreateResponse, EnsureResult, error) {
+	return c.EnsureRoleWithContext(context.Background(), r)
+}
+
+func (c *Client) EnsureRoleWithContext(ctx context.Context, r types.RoleCreate) (*types.RoleCreateResponse, EnsureResult, error) {
+
+	role, err := c.findRole(ctx, r.RoleInfo)
+	if err != nil {
+		return nil, Unchanged, err
+	}
+	if role != nil {
+		return role, Unchanged, nil
+	}
+	role, err = c.CreateRoleWithContext(ctx, r)
+	if err == nil {
+		return role, Created, nil
+	}
+	if !clients.IsConflict(err) {
+		return nil, Unchanged, err
+	}
+	role, err = c.findRole(ctx, r.RoleInfo)
+	if err != nil {
+		return nil, Unchanged, err
+	}
+	if role == nil {
+		return nil, Unchanged, errors.New("aasClient.EnsureRole: role reported as existing but not found: " + r.Service + ":" + r.Name)
+	}
+	return role, Unchanged, nil
+}
+
+// EnsureUserRoles makes sure that all of the roles exist and are bound to the user. Roles
+// bound to the user that are not in roles are kept. The result of each role is returned keyed
+// by service:name[:context]: Created when the role had to be created, Changed when an existing
+// role had to be bound and Unchanged when it was already bound. A role found bound by someone
+// else after AAS reported a conflict is Unchanged as well, a role that is still not bound
+// after the conflict is an error.
+func (c *Client) EnsureUserRoles(userID string, roles []types.RoleCreate) (map[string]EnsureResult, error) {
+	return c.EnsureUserRolesWithContext(context.Background(), userID, roles)
+}
+
+func (c *Client) EnsureUserRolesWithContext(ctx context.Context, userID string, roles []types.RoleCreate) (map[string]EnsureResult, error) {
+
+	results := make(map[string]EnsureResult, len(roles))
+	boundIDs, err := c.boundRoleIDs(ctx, userID)
+	if err != nil {
+		return results, err
+	}
+
+	var missing []string
+	var missingNames []string
+	for _, r := range roles {
+		role, roleResult, err := c.EnsureRoleWithContext(ctx, r)
+		if err != nil {
+			return results, err
+		}
+		name := roleName(r.RoleInfo)
+		results[name] = roleResult
+		if !boundIDs[role.ID] {
+			missing = append(missing, role.ID)
+			missingNames = append(missingNames, name)
+			boundIDs[role.ID] = true
+		}
+	}
+	if len(missing) == 0 {
+		return results, nil
+	}
+	added, err := c.bindRoles(ctx, userID, missing)
+	for i, id := range missing {
+		if added[id] && results[missingNames[i]] == Unchanged {
+			results[missingNames[i]] = Changed
+		}
+	}
+	return results, err
+}
+
+func (c *Client) boundRoleIDs(ctx context.Context, userID string) (map[string]bool, error) {
+	bound, err := c.GetRolesForUserWithContext(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	boundIDs := make(map[string]bool, len(bound))
+	for _, r := range bound {
+		boundIDs[r.ID] = true
+	}
+	return boundIDs, nil
+}
+
+// bindRoles binds the roles to the user and returns the IDs of the roles bound by this call.
+// A conflict on the batch only tells that some of the roles are bound already, so the roles of
+// the user are read again and the ones still missing are bound one at a time.
+func (c *Client) bindRoles(ctx context.Context, userID string, roleIDs []string) (map[string]bool, error) {
+
+	added := make(map[string]bool, len(roleIDs))
+	err := c.AddRoleToUserWithContext(ctx, userID, types.RoleIDs{RoleUUIDs: roleIDs})
+	if err == nil {
+		for _, id := range roleIDs {
+			added[id] = true
+		}
+		return added, nil
+	}
+	if !clients.IsConflict(err) {
+		return added, err
+	}
+	boundIDs, err := c.boundRoleIDs(ctx, userID)
+	if err != nil {
+		return added, err
+	}
+	var conflicts bool
+	for _, id := range roleIDs {
+		if boundIDs[id] {
+			continue
+		}
+		err = c.AddRoleToUserWithContext(ctx, userID, types.RoleIDs{RoleUUIDs: []string{id}})
+		if err == nil {
+			added[id] = true
+			continue
+		}
+		if !clients.IsConflict(err) {
+			return added, err
+		}
+		conflicts = true
+	}
+	if !conflicts {
+		return added, nil
+	}
+	boundIDs, err = c.boundRoleIDs(ctx, userID)
+	if err != nil {
+		return added, err
+	}
+	for _, id := range roleIDs {
+		if !boundIDs[id] && !added[id] {
+			return added, fmt.Errorf("aasClient: role %s not bound to user %s despite conflict", id, userID)
+		}
+	}
+	return added, nil
+}
@@ -0,0 +1,245 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package aas
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	types "intel/isecl/lib/common/v5/types/aas"
+)
+
+// aasStore is an in memory AAS backing the stateful mock server
+type aasStore struct {
+	mu       sync.Mutex
+	users    map[string]types.UserCreateResponse
+	roles    map[string]types.RoleCreate
+	bindings map[string]map[string]bool
+	// partialConflict makes batches of more than one role bind only the first role and answer
+	// with a conflict, as if someone else bound it
+	partialConflict bool
+	// rejectBinds makes role bindings answer with a conflict without binding anything
+	rejectBinds bool
+}
+
+func (s *aasStore) roleResponse(id string) types.RoleCreateResponse {
+	return types.RoleCreateResponse{ID: id, Service: s.roles[id].Service, Name: s.roles[id].Name}
+}
+
+func (s *aasStore) createUser(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var u types.UserCreate
+	_ = json.NewDecoder(r.Body).Decode(&u)
+	for _, user := range s.users {
+		if user.Name == u.Name {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+	}
+	user := types.UserCreateResponse{ID: uuid.New().String(), Name: u.Name}
+	s.users[user.ID] = user
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(user)
+}
+
+func (s *aasStore) getUsers(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users := []types.UserCreateResponse{}
+	for _, user := range s.users {
+		if user.Name == r.URL.Query().Get("name") {
+			users = append(users, user)
+		}
+	}
+	_ = json.NewEncoder(w).Encode(users)
+}
+
+func (s *aasStore) createRole(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rc types.RoleCreate
+	_ = json.NewDecoder(r.Body).Decode(&rc)
+	for _, role := range s.roles {
+		if role.RoleInfo == rc.RoleInfo {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+	}
+	id := uuid.New().String()
+	s.roles[id] = rc
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(s.roleResponse(id))
+}
+
+func (s *aasStore) getRoles(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := r.URL.Query()
+	roles := []types.RoleCreateResponse{}
+	for id, role := range s.roles {
+		if role.Service == q.Get("service") && role.Name == q.Get("name") && role.Context == q.Get("context") {
+			roles = append(roles, s.roleResponse(id))
+		}
+	}
+	_ = json.NewEncoder(w).Encode(roles)
+}
+
+func (s *aasStore) getUserRoles(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	roles := []types.RoleCreateResponse{}
+	for id := range s.bindings[mux.Vars(r)["id"]] {
+		roles = append(roles, s.roleResponse(id))
+	}
+	_ = json.NewEncoder(w).Encode(roles)
+}
+
+func (s *aasStore) addUserRoles(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	userID := mux.Vars(r)["id"]
+	var ids types.RoleIDs
+	_ = json.NewDecoder(r.Body).Decode(&ids)
+	if s.bindings[userID] == nil {
+		s.bindings[userID] = make(map[string]bool)
+	}
+	switch {
+	case s.rejectBinds:
+		w.WriteHeader(http.StatusConflict)
+	case s.partialConflict && len(ids.RoleUUIDs) > 1:
+		s.bindings[userID][ids.RoleUUIDs[0]] = true
+		w.WriteHeader(http.StatusConflict)
+	default:
+		for _, id := range ids.RoleUUIDs {
+			s.bindings[userID][id] = true
+		}
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// aasStatefulMockServer serves the users and roles APIs of AAS from an in memory store
+func aasStatefulMockServer(t *testing.T) (*http.Server, string, *aasStore) {
+	store := &aasStore{
+		users:    make(map[string]types.UserCreateResponse),
+		roles:    make(map[string]types.RoleCreate),
+		bindings: make(map[string]map[string]bool),
+	}
+	handler := mux.NewRouter()
+	handler.HandleFunc("/aas/users", store.createUser).Methods("POST")
+	handler.HandleFunc("/aas/users", store.getUsers).Methods("GET")
+	handler.HandleFunc("/aas/roles", store.createRole).Methods("POST")
+	handler.HandleFunc("/aas/roles", store.getRoles).Methods("GET")
+	handler.HandleFunc("/aas/users/{id}/roles", store.getUserRoles).Methods("GET")
+	handler.HandleFunc("/aas/users/{id}/roles", store.addUserRoles).Methods("POST")
+
+	srv, port := mockServerLauncher(t, handler)
+	return srv, port, store
+}
+
+func TestEnsure(t *testing.T) {
+
+	aasMockSrv, port, store := aasStatefulMockServer(t)
+	defer aasMockSrv.Close()
+
+	aasClient := Client{
+		BaseURL:    "http://localhost" + port + "/aas",
+		JWTToken:   []byte(aasToken),
+		HTTPClient: http.DefaultClient,
+	}
+
+	userCreate := types.UserCreate{Name: "ta_service", Password: "password"}
+	user, result, err := aasClient.EnsureUser(userCreate)
+	assert.NoError(t, err, "user should be ensured")
+	assert.Equal(t, Created, result)
+
+	again, result, err := aasClient.EnsureUser(userCreate)
+	assert.NoError(t, err, "existing user should be ensured")
+	assert.Equal(t, Unchanged, result)
+	assert.Equal(t, user.ID, again.ID)
+
+	roles := []types.RoleCreate{
+		{RoleInfo: types.RoleInfo{Service: "TA", Name: "Administrator"}, Permissions: []string{"*:*:*"}},
+		{RoleInfo: types.RoleInfo{Service: "CMS", Name: "CertApprover", Context: "CN=Trust Agent TLS Certificate"}},
+	}
+	role, result, err := aasClient.EnsureRole(roles[0])
+	assert.NoError(t, err, "role should be ensured")
+	assert.Equal(t, Created, result)
+
+	_, result, err = aasClient.EnsureRole(roles[0])
+	assert.NoError(t, err, "existing role should be ensured")
+	assert.Equal(t, Unchanged, result)
+
+	results, err := aasClient.EnsureUserRoles(user.ID, roles)
+	assert.NoError(t, err, "user roles should be ensured")
+	assert.Equal(t, map[string]EnsureResult{
+		"TA:Administrator": Changed,
+		"CMS:CertApprover:CN=Trust Agent TLS Certificate": Created,
+	}, results)
+	assert.Len(t, store.roles, 2)
+	assert.Len(t, store.bindings[user.ID], 2)
+	assert.True(t, store.bindings[user.ID][role.ID])
+
+	results, err = aasClient.EnsureUserRoles(user.ID, roles)
+	assert.NoError(t, err, "bound user roles should be ensured")
+	assert.Equal(t, map[string]EnsureResult{
+		"TA:Administrator": Unchanged,
+		"CMS:CertApprover:CN=Trust Agent TLS Certificate": Unchanged,
+	}, results)
+
+	other, _, err := aasClient.EnsureUser(types.UserCreate{Name: "wls_service", Password: "password"})
+	assert.NoError(t, err, "user should be ensured")
+	store.mu.Lock()
+	store.partialConflict = true
+	store.mu.Unlock()
+	results, err = aasClient.EnsureUserRoles(other.ID, roles)
+	assert.NoError(t, err, "roles missing after a conflict should be bound")
+	assert.Equal(t, map[string]EnsureResult{
+		"TA:Administrator": Unchanged,
+		"CMS:CertApprover:CN=Trust Agent TLS Certificate": Changed,
+	}, results)
+	assert.Len(t, store.bindings[other.ID], 2, "all of the roles should be bound")
+
+	third, _, err := aasClient.EnsureUser(types.UserCreate{Name: "hvs_service", Password: "password"})
+	assert.NoError(t, err, "user should be ensured")
+	store.mu.Lock()
+	store.rejectBinds = true
+	store.mu.Unlock()
+	_, err = aasClient.EnsureUserRoles(third.ID, roles)
+	assert.Error(t, err, "roles still unbound after a conflict should be reported")
+	assert.Empty(t, store.bindings[third.ID])
+}
+
+func TestEnsureCanceled(t *testing.T) {
+
+	aasMockSrv, port, store := aasStatefulMockServer(t)
+	defer aasMockSrv.Close()
+
+	aasClient := Client{
+		BaseURL:    "http://localhost" + port + "/aas",
+		JWTToken:   []byte(aasToken),
+		HTTPClient: http.DefaultClient,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := aasClient.EnsureUserWithContext(ctx, types.UserCreate{Name: "ta_service", Password: "password"})
+	assert.True(t, errors.Is(err, context.Canceled), "canceled context should stop EnsureUser")
+	_, _, err = aasClient.EnsureRoleWithContext(ctx, types.RoleCreate{RoleInfo: types.RoleInfo{Service: "TA", Name: "Administrator"}})
+	assert.True(t, errors.Is(err, context.Canceled), "canceled context should stop EnsureRole")
+	m, err := ParseManifest([]byte(`roles: [{service: TA, name: Administrator}]`))
+	assert.NoError(t, err, "manifest should be parsed")
+	_, err = aasClient.PlanWithContext(ctx, m)
+	assert.True(t, errors.Is(err, context.Canceled), "canceled context should stop Plan")
+	assert.Empty(t, store.users)
+	assert.Empty(t, store.roles)
+}
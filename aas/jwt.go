@@ -6,14 +6,21 @@ package aas
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"intel/isecl/lib/clients/v5"
 	types "intel/isecl/lib/common/v5/types/aas"
+
+	log "github.com/sirupsen/logrus"
 )
 
 type JWTClientErr struct {
@@ -25,6 +32,20 @@ func (ucErr *JWTClientErr) Error() string {
 	return fmt.Sprintf("%s: %s", ucErr.ErrMessage, ucErr.ErrInfo)
 }
 
+// Is reports whether target is a JWTClientErr with the same message
+func (ucErr *JWTClientErr) Is(target error) bool {
+	t, ok := target.(*JWTClientErr)
+	return ok && t.ErrMessage == ucErr.ErrMessage
+}
+
+// newJWTClientErr returns a copy of sentinel carrying the information info
+func newJWTClientErr(sentinel *JWTClientErr, info string) *JWTClientErr {
+	return &JWTClientErr{
+		ErrMessage: sentinel.ErrMessage,
+		ErrInfo:    info,
+	}
+}
+
 var (
 	ErrHTTPGetJWTCert = &clients.HTTPClientErr{
 		ErrMessage: "Failed to retrieve JWT signing certificate",
@@ -40,28 +61,136 @@ var (
 		ErrMessage: "User token not yet fetched",
 		ErrInfo:    "",
 	}
+	ErrUserCredential = &JWTClientErr{
+		ErrMessage: "Failed to retrieve user credential",
+		ErrInfo:    "",
+	}
 )
 
+// JWTTokenProvider fetches and holds the AAS tokens of a set of users. It is implemented by
+// the client returned by NewJWTClient and by FakeJWTTokenProvider for unit tests.
+type JWTTokenProvider interface {
+	AddUser(username, password string)
+	AddUserWithCredential(username string, cred CredentialSource)
+	RemoveUser(username string)
+	UpdateUserPassword(username, password string) error
+	FetchTokenForUser(username string) ([]byte, error)
+	FetchTokenForUserWithContext(ctx context.Context, username string) ([]byte, error)
+	GetUserToken(username string) ([]byte, error)
+	FetchAllTokens() error
+	FetchAllTokensWithContext(ctx context.Context) error
+	GetJWTSigningCert() ([]byte, error)
+	GetJWTSigningCertWithContext(ctx context.Context) ([]byte, error)
+}
+
+var _ JWTTokenProvider = (*jwtClient)(nil)
+
+const (
+	// DefaultTokenExpirySkew is the TokenExpirySkew used when none is set
+	DefaultTokenExpirySkew = time.Minute
+	// DefaultFetchConcurrency is the FetchConcurrency used when none is set
+	DefaultFetchConcurrency = 4
+)
+
+// FetchAllTokensError is returned by FetchAllTokens when the tokens of some of the users
+// could not be fetched. The tokens of all other users are fetched nonetheless.
+type FetchAllTokensError struct {
+	// Errors holds the error of each user whose token could not be fetched
+	Errors map[string]error
+}
+
+func (e *FetchAllTokensError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, username := range e.Users() {
+		msgs = append(msgs, username+": "+e.Errors[username].Error())
+	}
+	return fmt.Sprintf("Failed to retrieve JWT token for %d user(s): %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// Users returns the sorted names of the users whose token could not be fetched
+func (e *FetchAllTokensError) Users() []string {
+	usernames := make([]string, 0, len(e.Errors))
+	for username := range e.Errors {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+	return usernames
+}
+
+// Is reports whether the error of any of the users matches target
+func (e *FetchAllTokensError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// jwtClient is safe for concurrent use. Concurrent fetches of the token of the same user
+// are collapsed into a single request to AAS.
+//
+// Tokens expiring within TokenExpirySkew are considered stale and fetched again by
+// GetUserToken. OnRefreshError, when set, is called whenever fetching a new token in place
+// of a stale or expiring one fails.
+//
+// FetchAllTokens requests the tokens of up to FetchConcurrency users at a time.
+//
+// When TokenStore is set, fetched tokens are saved to it, and tokens saved by other processes
+// are reused as long as they do not expire within TokenExpirySkew.
 type jwtClient struct {
-	BaseURL    string
-	HTTPClient *http.Client
+	BaseURL          string
+	HTTPClient       *http.Client
+	TokenExpirySkew  time.Duration
+	OnRefreshError   func(username string, err error)
+	FetchConcurrency int
+	TokenStore       TokenStore
+
+	mu       sync.RWMutex
+	users    map[string]*userCredential
+	tokens   map[string]*cachedToken
+	inflight map[string]*tokenFetch
+}
+
+// userCredential is the credential source a user is registered with
+type userCredential struct {
+	source CredentialSource
+}
+
+// cachedToken is a fetched token along with its expiry, which is zero for tokens
+// that do not expire
+type cachedToken struct {
+	token  []byte
+	expiry time.Time
+}
 
-	users  map[string]*types.UserCred
-	tokens map[string][]byte
+// tokenFetch is a token request to AAS in progress, shared by all of the callers
+// fetching the token of the same user
+type tokenFetch struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+	token   []byte
+	err     error
 }
 
 func NewJWTClient(url string) *jwtClient {
 
 	ret := jwtClient{BaseURL: url}
-	ret.users = make(map[string]*types.UserCred)
-	ret.tokens = make(map[string][]byte)
+	ret.users = make(map[string]*userCredential)
+	ret.tokens = make(map[string]*cachedToken)
+	ret.inflight = make(map[string]*tokenFetch)
 	return &ret
 }
 
 func (c *jwtClient) GetJWTSigningCert() ([]byte, error) {
+	return c.GetJWTSigningCertWithContext(context.Background())
+}
+
+func (c *jwtClient) GetJWTSigningCertWithContext(ctx context.Context) ([]byte, error) {
 
 	jwtCertUrl := clients.ResolvePath(c.BaseURL, "noauth/jwt-certificates")
-	req, err := http.NewRequest(http.MethodGet, jwtCertUrl, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwtCertUrl, nil)
 	if err != nil {
 		return nil, errors.New("jwtClient.GetJWTSigningCert: failed initializing HTTP request: " + err.Error())
 	}
@@ -75,60 +204,318 @@ func (c *jwtClient) GetJWTSigningCert() ([]byte, error) {
 		return nil, err
 	}
 	if rsp.StatusCode != http.StatusOK {
-		ErrHTTPGetJWTCert.RetCode = rsp.StatusCode
-		return nil, ErrHTTPGetJWTCert
+		return nil, clients.NewHTTPClientErr(ErrHTTPGetJWTCert, rsp)
 	}
 	return ioutil.ReadAll(rsp.Body)
 }
 
 func (c *jwtClient) AddUser(username, password string) {
-	c.users[username] = &types.UserCred{
-		UserName: username,
-		Password: password,
+	c.AddUserWithCredential(username, StaticCredential(password))
+}
+
+// AddUserWithCredential registers username with the password supplied by cred, which is
+// consulted on every token fetch. A user registered before is replaced.
+func (c *jwtClient) AddUserWithCredential(username string, cred CredentialSource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.users[username] = &userCredential{source: cred}
+}
+
+// RemoveUser unregisters username and discards its token
+func (c *jwtClient) RemoveUser(username string) {
+	c.mu.Lock()
+	delete(c.users, username)
+	delete(c.tokens, username)
+	c.mu.Unlock()
+	if c.TokenStore != nil {
+		if err := c.TokenStore.Delete(TokenStoreKey(c.BaseURL, username)); err != nil {
+			log.WithError(err).Warnf("aas/jwt: failed to delete stored token of %s", username)
+		}
+	}
+}
+
+// UpdateUserPassword replaces the password of username. The token fetched before is kept
+// until it is fetched again.
+func (c *jwtClient) UpdateUserPassword(username, password string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.users[username]; !ok {
+		return newJWTClientErr(ErrUserNotFound, username)
+	}
+	c.users[username] = &userCredential{source: StaticCredential(password)}
+	return nil
+}
+
+func (c *jwtClient) expirySkew() time.Duration {
+	if c.TokenExpirySkew == 0 {
+		return DefaultTokenExpirySkew
 	}
+	return c.TokenExpirySkew
 }
 
+// expiresWithin reports whether the token expires within d from now
+func (t *cachedToken) expiresWithin(d time.Duration) bool {
+	return !t.expiry.IsZero() && time.Now().Add(d).After(t.expiry)
+}
+
+func (c *jwtClient) refreshFailed(username string, err error) {
+	if c.OnRefreshError != nil {
+		c.OnRefreshError(username, err)
+	}
+}
+
+// GetUserToken returns the token fetched for username. A token expiring within
+// TokenExpirySkew is replaced by a newly fetched one. Should fetching it fail, the failure
+// is reported to OnRefreshError and the token is still returned until it expires.
 func (c *jwtClient) GetUserToken(username string) ([]byte, error) {
 
+	c.mu.RLock()
+	_, ok := c.users[username]
+	cached := c.tokens[username]
+	c.mu.RUnlock()
+	if !ok {
+		return nil, newJWTClientErr(ErrUserNotFound, username)
+	}
+	if cached == nil {
+		cached = c.loadStoredToken(username)
+	}
+	if cached == nil {
+		return nil, newJWTClientErr(ErrJWTNotYetFetched, username)
+	}
+	if !cached.expiresWithin(c.expirySkew()) {
+		return cached.token, nil
+	}
+	token, err := c.FetchTokenForUser(username)
+	if err != nil {
+		c.refreshFailed(username, err)
+		if cached.expiresWithin(0) {
+			return nil, err
+		}
+		return cached.token, nil
+	}
+	return token, nil
+}
+
+// loadStoredToken returns the token of username saved to TokenStore, if any, and caches it.
+// Tokens without expiry or expiring within TokenExpirySkew are not reused.
+func (c *jwtClient) loadStoredToken(username string) *cachedToken {
+
+	if c.TokenStore == nil {
+		return nil
+	}
+	token, err := c.TokenStore.Load(TokenStoreKey(c.BaseURL, username))
+	if err != nil {
+		log.WithError(err).Warnf("aas/jwt: failed to load stored token of %s", username)
+		return nil
+	}
+	if token == nil {
+		return nil
+	}
+	sc, err := parseStandardClaims(token)
+	if err != nil || sc.ExpiresAt == 0 {
+		return nil
+	}
+	cached := &cachedToken{token: token, expiry: sc.ExpiryTime()}
+	if cached.expiresWithin(c.expirySkew()) {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if _, ok := c.users[username]; !ok {
-		ErrUserNotFound.ErrInfo = username
-		return nil, ErrUserNotFound
+		return nil
 	}
-	token, ok := c.tokens[username]
-	if ok {
-		return token, nil
+	if c.tokens[username] == nil {
+		c.tokens[username] = cached
 	}
-	ErrJWTNotYetFetched.ErrInfo = username
-	return nil, ErrJWTNotYetFetched
+	return c.tokens[username]
 }
 
-func (c *jwtClient) FetchAllTokens() error {
+// StartRefresher starts renewing the fetched tokens in the background before they expire,
+// until ctx is done. Tokens are renewed once they expire within renewBefore, which should
+// be larger than TokenExpirySkew so that GetUserToken does not need to fetch them itself.
+func (c *jwtClient) StartRefresher(ctx context.Context, renewBefore time.Duration) {
+
+	interval := renewBefore / 4
+	if interval < 100*time.Millisecond {
+		interval = 100 * time.Millisecond
+	} else if interval > time.Minute {
+		interval = time.Minute
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.refreshExpiring(ctx, renewBefore)
+			}
+		}
+	}()
+}
+
+func (c *jwtClient) refreshExpiring(ctx context.Context, renewBefore time.Duration) {
 
-	for user, userCred := range c.users {
-		token, err := c.fetchToken(userCred)
-		if err != nil {
-			return err
+	var expiring []string
+	c.mu.RLock()
+	for username, cached := range c.tokens {
+		if cached.expiresWithin(renewBefore) {
+			expiring = append(expiring, username)
 		}
-		c.tokens[user] = token
+	}
+	c.mu.RUnlock()
+
+	for _, username := range expiring {
+		if _, err := c.FetchTokenForUserWithContext(ctx, username); err != nil && ctx.Err() == nil {
+			c.refreshFailed(username, err)
+		}
+	}
+}
+
+func (c *jwtClient) FetchAllTokens() error {
+	return c.FetchAllTokensWithContext(context.Background())
+}
+
+func (c *jwtClient) fetchConcurrency() int {
+	if c.FetchConcurrency <= 0 {
+		return DefaultFetchConcurrency
+	}
+	return c.FetchConcurrency
+}
+
+// FetchAllTokensWithContext fetches the tokens of all users, FetchConcurrency at a time. The
+// failure of one user does not keep the tokens of the others from being fetched, the
+// failures are reported together in a *FetchAllTokensError. Users without a token yet whose
+// token can be reused from TokenStore are not fetched.
+func (c *jwtClient) FetchAllTokensWithContext(ctx context.Context) error {
+
+	c.mu.RLock()
+	usernames := make([]string, 0, len(c.users))
+	for username := range c.users {
+		usernames = append(usernames, username)
+	}
+	c.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	var errsMu sync.Mutex
+	errs := make(map[string]error)
+	sem := make(chan struct{}, c.fetchConcurrency())
+	for _, username := range usernames {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(username string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			c.mu.RLock()
+			cached := c.tokens[username]
+			c.mu.RUnlock()
+			if cached == nil && c.loadStoredToken(username) != nil {
+				return
+			}
+			if _, err := c.FetchTokenForUserWithContext(ctx, username); err != nil {
+				errsMu.Lock()
+				errs[username] = err
+				errsMu.Unlock()
+			}
+		}(username)
+	}
+	wg.Wait()
+
+	if len(errs) != 0 {
+		return &FetchAllTokensError{Errors: errs}
 	}
 	return nil
 }
 
 func (c *jwtClient) FetchTokenForUser(username string) ([]byte, error) {
+	return c.FetchTokenForUserWithContext(context.Background(), username)
+}
+
+// FetchTokenForUserWithContext fetches a new token for username. Concurrent callers share
+// a single request to AAS, which does not depend on the context of any of them: a caller
+// whose ctx is done stops waiting for it, and it is cancelled once all callers stopped
+// waiting.
+func (c *jwtClient) FetchTokenForUserWithContext(ctx context.Context, username string) ([]byte, error) {
 
-	userCred, ok := c.users[username]
+	c.mu.Lock()
+	cred, ok := c.users[username]
+	if !ok {
+		c.mu.Unlock()
+		return nil, newJWTClientErr(ErrUserNotFound, username)
+	}
+	f, ok := c.inflight[username]
 	if !ok {
-		return nil, ErrUserNotFound
+		fetchCtx, cancel := context.WithCancel(context.Background())
+		f = &tokenFetch{done: make(chan struct{}), cancel: cancel}
+		c.inflight[username] = f
+		go c.runFetch(fetchCtx, username, cred, f)
 	}
-	token, err := c.fetchToken(userCred)
+	f.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.token, f.err
+	case <-ctx.Done():
+		c.mu.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			// nobody is waiting anymore, later callers start a new fetch
+			f.cancel()
+			if c.inflight[username] == f {
+				delete(c.inflight, username)
+			}
+		}
+		c.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// runFetch performs the fetch f of the token of username and caches the token
+func (c *jwtClient) runFetch(ctx context.Context, username string, cred *userCredential, f *tokenFetch) {
+
+	defer f.cancel()
+	password, err := cred.source.Password()
 	if err != nil {
-		return nil, err
+		f.err = newJWTClientErr(ErrUserCredential, username+": "+err.Error())
+	} else {
+		f.token, f.err = c.fetchToken(ctx, &types.UserCred{
+			UserName: username,
+			Password: password,
+		})
+	}
+
+	cached := &cachedToken{token: f.token}
+	if f.err == nil {
+		// tokens that can not be parsed are kept, but never considered stale
+		if sc, err := parseStandardClaims(f.token); err == nil {
+			cached.expiry = sc.ExpiryTime()
+		}
+	}
+
+	c.mu.Lock()
+	if c.inflight[username] == f {
+		delete(c.inflight, username)
+	}
+	// the token is dropped when the user was removed or replaced in the meantime
+	keep := f.err == nil && c.users[username] == cred
+	if keep {
+		c.tokens[username] = cached
+	}
+	c.mu.Unlock()
+	close(f.done)
+
+	if keep && c.TokenStore != nil {
+		if err := c.TokenStore.Save(TokenStoreKey(c.BaseURL, username), f.token); err != nil {
+			log.WithError(err).Warnf("aas/jwt: failed to store token of %s", username)
+		}
 	}
-	c.tokens[username] = token
-	return token, nil
 }
 
-func (c *jwtClient) fetchToken(userCred *types.UserCred) ([]byte, error) {
+func (c *jwtClient) fetchToken(ctx context.Context, userCred *types.UserCred) ([]byte, error) {
 
 	var err error
 
@@ -138,7 +525,7 @@ func (c *jwtClient) fetchToken(userCred *types.UserCred) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest("POST", jwtUrl, buf)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, jwtUrl, buf)
 	if err != nil {
 		return nil, errors.New("jwtClient.fetchToken: failed initializing HTTP request: " + err.Error())
 	}
@@ -152,8 +539,7 @@ func (c *jwtClient) fetchToken(userCred *types.UserCred) ([]byte, error) {
 		return nil, err
 	}
 	if rsp.StatusCode != http.StatusOK {
-		ErrHTTPFetchJWTToken.RetCode = rsp.StatusCode
-		return nil, ErrHTTPFetchJWTToken
+		return nil, clients.NewHTTPClientErr(ErrHTTPFetchJWTToken, rsp)
 	}
 	jwtToken, err := ioutil.ReadAll(rsp.Body)
 	if err != nil {
@@ -161,3 +547,26 @@ func (c *jwtClient) fetchToken(userCred *types.UserCred) ([]byte, error) {
 	}
 	return jwtToken, nil
 }
+
+type jwtTokenSource struct {
+	jwt      JWTTokenProvider
+	username string
+}
+
+// NewJWTTokenSource returns a TokenSource supplying the token of username from jwt. The
+// token is fetched from AAS on first use and fetched again when a service rejects it.
+func NewJWTTokenSource(jwt JWTTokenProvider, username string) clients.TokenSource {
+	return &jwtTokenSource{jwt: jwt, username: username}
+}
+
+func (s *jwtTokenSource) Token() ([]byte, error) {
+	token, err := s.jwt.GetUserToken(s.username)
+	if errors.Is(err, ErrJWTNotYetFetched) {
+		return s.jwt.FetchTokenForUser(s.username)
+	}
+	return token, err
+}
+
+func (s *jwtTokenSource) Refresh() ([]byte, error) {
+	return s.jwt.FetchTokenForUser(s.username)
+}
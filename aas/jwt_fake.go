@@ -0,0 +1,160 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package aas
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"intel/isecl/lib/clients/v5"
+)
+
+// FakeJWTTokenProvider is an in memory JWTTokenProvider for unit tests of code depending on
+// AAS tokens. Tokens are issued from Tokens, or made up from the user name when the user has
+// no entry there. FetchErr, when set, is returned by every fetch.
+type FakeJWTTokenProvider struct {
+	SigningCert []byte
+	Tokens      map[string][]byte
+	FetchErr    error
+
+	mu      sync.Mutex
+	users   map[string]CredentialSource
+	fetched map[string][]byte
+}
+
+var _ JWTTokenProvider = (*FakeJWTTokenProvider)(nil)
+
+func NewFakeJWTTokenProvider() *FakeJWTTokenProvider {
+	return &FakeJWTTokenProvider{
+		Tokens:  make(map[string][]byte),
+		users:   make(map[string]CredentialSource),
+		fetched: make(map[string][]byte),
+	}
+}
+
+func (f *FakeJWTTokenProvider) AddUser(username, password string) {
+	f.AddUserWithCredential(username, StaticCredential(password))
+}
+
+func (f *FakeJWTTokenProvider) AddUserWithCredential(username string, cred CredentialSource) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.users[username] = cred
+}
+
+// RemoveUser unregisters username and discards its token
+func (f *FakeJWTTokenProvider) RemoveUser(username string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.users, username)
+	delete(f.fetched, username)
+}
+
+// UpdateUserPassword replaces the password of username
+func (f *FakeJWTTokenProvider) UpdateUserPassword(username, password string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.users[username]; !ok {
+		return newJWTClientErr(ErrUserNotFound, username)
+	}
+	f.users[username] = StaticCredential(password)
+	return nil
+}
+
+// Password returns the current password of username
+func (f *FakeJWTTokenProvider) Password(username string) (string, bool) {
+	f.mu.Lock()
+	cred, ok := f.users[username]
+	f.mu.Unlock()
+	if !ok {
+		return "", false
+	}
+	password, err := cred.Password()
+	return password, err == nil
+}
+
+func (f *FakeJWTTokenProvider) FetchTokenForUser(username string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.fetch(username)
+}
+
+func (f *FakeJWTTokenProvider) FetchTokenForUserWithContext(ctx context.Context, username string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return f.FetchTokenForUser(username)
+}
+
+func (f *FakeJWTTokenProvider) fetch(username string) ([]byte, error) {
+	cred, ok := f.users[username]
+	if !ok {
+		return nil, newJWTClientErr(ErrUserNotFound, username)
+	}
+	if _, err := cred.Password(); err != nil {
+		return nil, newJWTClientErr(ErrUserCredential, username+": "+err.Error())
+	}
+	if f.FetchErr != nil {
+		return nil, f.FetchErr
+	}
+	token, ok := f.Tokens[username]
+	if !ok {
+		token = []byte("fake-token-" + username)
+	}
+	f.fetched[username] = token
+	return token, nil
+}
+
+func (f *FakeJWTTokenProvider) GetUserToken(username string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.users[username]; !ok {
+		return nil, newJWTClientErr(ErrUserNotFound, username)
+	}
+	if token, ok := f.fetched[username]; ok {
+		return token, nil
+	}
+	return nil, newJWTClientErr(ErrJWTNotYetFetched, username)
+}
+
+func (f *FakeJWTTokenProvider) FetchAllTokens() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	errs := make(map[string]error)
+	for username := range f.users {
+		if _, err := f.fetch(username); err != nil {
+			errs[username] = err
+		}
+	}
+	if len(errs) != 0 {
+		return &FetchAllTokensError{Errors: errs}
+	}
+	return nil
+}
+
+func (f *FakeJWTTokenProvider) FetchAllTokensWithContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return f.FetchAllTokens()
+}
+
+func (f *FakeJWTTokenProvider) GetJWTSigningCertWithContext(ctx context.Context) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return f.GetJWTSigningCert()
+}
+
+func (f *FakeJWTTokenProvider) GetJWTSigningCert() ([]byte, error) {
+	if f.SigningCert == nil {
+		return nil, &clients.HTTPClientErr{
+			ErrMessage: ErrHTTPGetJWTCert.ErrMessage,
+			RetCode:    http.StatusNotFound,
+		}
+	}
+	return f.SigningCert, nil
+}
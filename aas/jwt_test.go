@@ -5,20 +5,28 @@
 package aas
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
+	"intel/isecl/lib/clients/v5"
 	types "intel/isecl/lib/common/v5/types/aas"
 	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 const (
 	aasToken       = "eyJ0eXAiOiJKV1QiLCJhbGciOiJIUzI1NiJ9.eyJyb2xlcyI6W3sic2VydmljZSI6IkFBUyIsIm5hbWUiOiJSb2xlTWFuYWdlciJ9LHsic2VydmljZSI6IkFBUyIsIm5hbWUiOiJVc2VyTWFuYWdlciJ9LHsic2VydmljZSI6IkFBUyIsIm5hbWUiOiJVc2VyUm9sZU1hbmFnZXIifSx7InNlcnZpY2UiOiJUQSIsIm5hbWUiOiJBZG1pbmlzdHJhdG9yIn0seyJzZXJ2aWNlIjoiVlMiLCJuYW1lIjoiQWRtaW5pc3RyYXRvciJ9LHsic2VydmljZSI6IktNUyIsIm5hbWUiOiJLZXlDUlVEIn0seyJzZXJ2aWNlIjoiQUgiLCJuYW1lIjoiQWRtaW5pc3RyYXRvciJ9LHsic2VydmljZSI6IldMUyIsIm5hbWUiOiJBZG1pbmlzdHJhdG9yIn1dLCJwZXJtaXNzaW9ucyI6W3sic2VydmljZSI6IkFIIiwicnVsZXMiOlsiKjoqOioiXX0seyJzZXJ2aWNlIjoiS01TIiwicnVsZXMiOlsiKjoqOioiXX0seyJzZXJ2aWNlIjoiVEEiLCJydWxlcyI6WyIqOio6KiJdfSx7InNlcnZpY2UiOiJWUyIsInJ1bGVzIjpbIio6KjoqIl19LHsic2VydmljZSI6IldMUyIsInJ1bGVzIjpbIio6KjoqIl19XSwiZXhwIjoxNjA2Mjg1MDA0LCJpYXQiOjE1OTQ0NzQwMDEsImlzcyI6IkFBUyBKV1QgSXNzdWVyIiwic3ViIjoiYWRtaW4iLCJqdGkiOiJmOTBlZGU4YS00MzU5LTQyZTktOTU0ZS0wNDA5MmI4YmE3YjQifQ.g_UFb8xHLIL8nFNQ3XGE2ne4Eic0MFTdcZ_dQjoCDMQ"
+	mockUserID     = "4a6da8a9-9b56-4d42-9d0a-0f3e8e5a8d2e"
+	mockRoleID     = "2f4c0c6e-51c7-4a8d-a8b6-77d1ad6b2e11"
 	jwtCertsB64Enc = "LS0tLS1CRUdJTiBDRVJUSUZJQ0FURS0tLS0tCk1JSUVBekNDQW11Z0F3SUJBZ0lCQmpBTkJna3Foa2lHOXcwQkFRd0ZBREJRTVFzd0NRWURWUVFHRXdKVlV6RUwKTUFrR0ExVUVDQk1DVTBZeEN6QUpCZ05WQkFjVEFsTkRNUTR3REFZRFZRUUtFd1ZKVGxSRlRERVhNQlVHQTFVRQpBeE1PUTAxVElGTnBaMjVwYm1jZ1EwRXdIaGNOTWpBeE1URXdNRE14TURNNVdoY05NakV4TVRFd01ETXhNRE01CldqQW1NU1F3SWdZRFZRUURFeHRCUVZNZ1NsZFVJRk5wWjI1cGJtY2dRMlZ5ZEdsbWFXTmhkR1V3Z2dHaU1BMEcKQ1NxR1NJYjNEUUVCQVFVQUE0SUJqd0F3Z2dHS0FvSUJnUUN2YjZOTXBQcEozMWhjY015Q0w3SUNQQWw1eDBCeAp2S0xDZWFJRy9WVnhqWlN1SlJ6MVJmdFJNR1RsS3hRY2p6TkNSNUdZSVA5T2ZHY0RUUzNnR1RvY1YwdzhhSVNnCnVhdG1ReHhPSEQ5blpUNjhsT0ZNT3JUM3dzMUpUY01Xd2kxeXBQb1NEdHVjbXBQSmJiVU1VVmMyN3ZUUFcwZk4KYjVBcnNMODBUVnhwSG9JZ0Y2ZUtFV29TZStFcEM2N2ZBN0lpaGl0NzY4U2pIMUNEQkxlOU1HNDlKSFlac2JNZgpQd2RtSTF4UjBmeS9raGRhcXVDZFBZenJWT0xjcnpGeFk2cnUrMVQ1N3JJYzFXcVhvL2RCWWNoMkF2TEQvbzdaCm1wcU9YWWRQWll4QmFMK2NMWHk0SGNKaG5XRU1BWDVjVWVqcWYrQTlzMWROcE9VZEpwRnhUdUpraGRuRERKVnUKOS9odVZoaWVxVXplOFY2aytnN3grUjhPWVNzMDZaSnovMEg3V2I0VXgwMDErRFI2SjZ4cjh5RFd0T3ZFcm8vdwpDQWJZdUJxN1VtZGw1NXdIdFE0dkhlaDhxY0ZYQ1pJbVpLTjYyTkZ6a1JnOExCTTAzQUxQWFZBR2ZwODlnNEx6CnRscXkvbXNVbmxrZ2JBVks0cjJCMFpIamhzN2doTVl4SVE4Q0F3RUFBYU1TTUJBd0RnWURWUjBQQVFIL0JBUUQKQWdiQU1BMEdDU3FHU0liM0RRRUJEQVVBQTRJQmdRQU4xUGlWeXVRNzU4QVAvVlR6S1BnS2ZlNCtZNHduQ2dycwpObUhKeHIrWGhFYjh3TzdMa3FXTWRMOTN0NWZ5REcrRXJXcEV6d2FUMDUxQThLbGJ6MjVNd0NjTncvb2RTRDNNCkQxdGY5L2ZMVVN0YVR1RjRpUEZpdnRpdWxZMmZKWC8vM0thbStsRHhYWndpZDlKemNPbDV6bGhhL0lZVFlLRlMKdzUwdVN0TlN2VXFPVjB6Q1BaQ0NPZ1BkeWM5SGs0OHI0V2FkZE96QlZ0a1NDMmd5SFA1cnorcE5GYUgwckJhMgorRk1pVjkvQkJkckxReG83dWxiVXRKRDJFYkdZdHlMQ1NQV3pGK244T0xMem16SmhNMjBNVWd6c3pvdnJSaGRkCi85bENjcU5mNzhjUFBHa1gzcWdUdVlyb2tYWlZmVHJ6NVpTVFRzOVpnd2pMbmk1YUhmSytUNmI3S09URXgzVm4KUG03aG9oeEduREdEK0tBZlZuVnZ4TDlWMEJLcTl6VVQ1aEYwa0FjS3lMdWk0YVVCcWxGeStQMm9RWVlhc293VgpmUWx6dE5kdjhqbzBFQ2F3RDVQcWQrZTZBd2dsakorWm5PZW0rakVhMGE2b0xBUDh4bFA3Ukp1UTFlUzZCdnhjCnVpTnNkalNqU0VJYUlockZEUXA0WDI5bXVoa0hlTG89Ci0tLS0tRU5EIENFUlRJRklDQVRFLS0tLS0KLS0tLS1CRUdJTiBDRVJUSUZJQ0FURS0tLS0tCk1JSUVOVENDQXAyZ0F3SUJBZ0lCQXpBTkJna3Foa2lHOXcwQkFRd0ZBREJITVFzd0NRWURWUVFHRXdKVlV6RUwKTUFrR0ExVUVDQk1DVTBZeEN6QUpCZ05WQkFjVEFsTkRNUTR3REFZRFZRUUtFd1ZKVGxSRlRERU9NQXdHQTFVRQpBeE1GUTAxVFEwRXdIaGNOTWpBeE1URXdNRE14TURNeFdoY05NalV4TVRFd01ETXhNRE14V2pCUU1Rc3dDUVlEClZRUUdFd0pWVXpFTE1Ba0dBMVVFQ0JNQ1UwWXhDekFKQmdOVkJBY1RBbE5ETVE0d0RBWURWUVFLRXdWSlRsUkYKVERFWE1CVUdBMVVFQXhNT1EwMVRJRk5wWjI1cGJtY2dRMEV3Z2dHaU1BMEdDU3FHU0liM0RRRUJBUVVBQTRJQgpqd0F3Z2dHS0FvSUJnUURYaFVySFVGbzE3QTdkOWpDUVVVTmprS0hVYlluK0EwaUlCTERNY0ZCNE8xcFYrMVh5CnRXMzE3Q2JuN05qRkY5ajA0TURVeWFLKzZKR1pxNEZ4VU5HeFF1QXlZWk9lVTFlV2NXczM5Z0JWemh3Z0s0N00KOVE4dnFHOGNITW10OGZiYUdjc0JCelM3dDRFbVNJNWtWVzJUNWVtSkE5MlhsVVEveWZhSmlGZDNLU3l5MDB6KwpKKzByVE4xT1ZTYWpsa1BKTm5hWCtQTmVzNEtLVGVsVEtZODRKMlBIaHhjNVRuRmRidTFBYlZ4Zkhlb1NWQ0hGCmw5R3NMWkxpcEJnMDZoWHBtSGxhd3Bzb2Z6QWFBNE9FN0xGZVlLSnMwZUF6dzVWcE4zV2hGemNrdFZxcDg1SnAKbXVTWGZYTTJRQUw5d0U1Ri8wSXpLMU9LR3pRRS9MaFFvVXNxYUd6bGZYc01IRjFPWjZJVGZKaG9YK1JMWEtYNApmWVo3Wi9xeE5SK2plQmxueW5FS0J1TFlVdThkRHN4WHAvTU8zdFFMU3BGL3M5dUc5WDZxeUxwVGQ3ckYxWlMrCm9mR1NNME9aTEJySHhEVkErbnhVVE40clg1My96Ymg2MVNWT2dIalJMQ3cwNXFYN3RncVhiQVlzQklFNDBqeTIKaG9lYUJiNGJkOWdzSHBzQ0F3RUFBYU1qTUNFd0RnWURWUjBQQVFIL0JBUURBZ0VHTUE4R0ExVWRFd0VCL3dRRgpNQU1CQWY4d0RRWUpLb1pJaHZjTkFRRU1CUUFEZ2dHQkFCKzdUVUlhTXBtUmp6R2Y4Ni8weDRBYUNHZHFmTmJkCkZ1N3RLZ0hIVlZYNGV5ZlNhNitBcEE5bnl3R2s5RVY5Q0FLenVRL0Q5R1g2ZHdSYjd2SVhNai80WklscXdLbUoKUVBjTm9CYm10Y2lnbXB3SmM2c016elBZRmFMRHAxNEVIMklvRldjNEVYRzNqT0E1ZkNXZktad3owT0JpcUFSegprd2hOTmF2dWRxR09pUldWNy9yVGw0aEh5VG1hdHUzaStOdlh2L3JSUVljeEwzZUkwNXUvWlpPTnZWdDhlajd0CnRaM0RDZ2UwUUhQS1ppK0Y3dkMwUWRjQVZjUEdEUHM3ZUFieUxqQlgrUGRPc3g5N3owQzBqL093VGdRbHQxNEkKMG00S0w4bXViNEVwcW9EN0dMaDFXN0xvaFp5RXNLeW1LR0I1T3JLWHJPVnBPVXFrMGJaUlBQOGx2WS8zWkxaUQpkYVdRUENRdjUybHVMRjVxR0tCbFFqZWw4NlB6K2tKczhvd2I3eUwxTmxaRktrTWJlK3JhTXlESUU5UVZzWUw3CkMrVHVUTGFuY2xtbjdJN2I1Nm1KcklXNWlXL3BDeDZFK0c2NGs5Z0dHdUxCQjk3RzdwNEM0TDg2QUU3SXltUSsKdzZKb3V6SGhiQUdCQVlDdU1lZW0wOXFQM0VpV01BQjk2UT09Ci0tLS0tRU5EIENFUlRJRklDQVRFLS0tLS0="
 )
 
@@ -28,6 +36,21 @@ func tokenMockGoodResponse(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write([]byte(aasToken))
 }
 
+func customClaimsTokenMockResponse(w http.ResponseWriter, r *http.Request) {
+	var cc CustomClaims
+	if r.Header.Get("Authorization") != "Bearer "+aasToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(&cc); err != nil || cc.Subject == "" || cc.ValiditySecs <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Header().Add("Content-Type", "application/jwt")
+	_, _ = w.Write([]byte(aasToken))
+}
+
 func roleCreateMockGoodResponse(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 	roleCResp := types.RoleCreateResponse{
@@ -38,11 +61,118 @@ func roleCreateMockGoodResponse(w http.ResponseWriter, r *http.Request) {
 	resp, _ := json.Marshal(roleCResp)
 	_, _ = w.Write(resp)
 }
+func userGetMockResponse(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if id != mockUserID {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	resp, _ := json.Marshal(types.UserCreateResponse{
+		ID:   mockUserID,
+		Name: "test_user",
+	})
+	_, _ = w.Write(resp)
+}
+
+func userDeleteMockResponse(w http.ResponseWriter, r *http.Request) {
+	if mux.Vars(r)["id"] != mockUserID {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func changePasswordMockResponse(w http.ResponseWriter, r *http.Request) {
+	var pc types.PasswordChange
+	if err := json.NewDecoder(r.Body).Decode(&pc); err != nil || pc.NewPassword != pc.PasswordConfirm {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("Confirm password does not match"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func roleGetMockResponse(w http.ResponseWriter, r *http.Request) {
+	if mux.Vars(r)["id"] != mockRoleID {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	resp, _ := json.Marshal(types.RoleCreateResponse{
+		Service: "test_service",
+		Name:    "test_name",
+		ID:      mockRoleID,
+	})
+	_, _ = w.Write(resp)
+}
+
+func roleDeleteMockResponse(w http.ResponseWriter, r *http.Request) {
+	if mux.Vars(r)["id"] != mockRoleID {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func userRolesGetMockResponse(w http.ResponseWriter, r *http.Request) {
+	if mux.Vars(r)["id"] != mockUserID {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	resp, _ := json.Marshal([]types.RoleCreateResponse{{
+		Service: "test_service",
+		Name:    "test_name",
+		ID:      mockRoleID,
+	}})
+	_, _ = w.Write(resp)
+}
+
+func userRoleDeleteMockResponse(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] != mockUserID || vars["role_id"] != mockRoleID {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func userPermissionsGetMockResponse(w http.ResponseWriter, r *http.Request) {
+	if mux.Vars(r)["id"] != mockUserID {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	permissions := []types.PermissionInfo{
+		{Service: "TA", Rules: []string{"*:*:*"}},
+		{Service: "VS", Rules: []string{"flavors:create:*", "flavors:search:*"}},
+	}
+	service := r.URL.Query().Get("service")
+	var filtered []types.PermissionInfo
+	for _, p := range permissions {
+		if service == "" || p.Service == service {
+			filtered = append(filtered, p)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	resp, _ := json.Marshal(filtered)
+	_, _ = w.Write(resp)
+}
+
 func aasMockServer(t *testing.T) (*http.Server, string) {
 	handler := mux.NewRouter()
 	handler.HandleFunc("/aas/noauth/jwt-certificates", mockJwtSigningCertResponse).Methods("GET")
 	handler.HandleFunc("/aas/token", tokenMockGoodResponse).Methods("POST")
+	handler.HandleFunc("/aas/custom-claims-token", customClaimsTokenMockResponse).Methods("POST")
 	handler.HandleFunc("/aas/roles", roleCreateMockGoodResponse).Methods("POST")
+	handler.HandleFunc("/aas/users/changepassword", changePasswordMockResponse).Methods("PATCH")
+	handler.HandleFunc("/aas/users/{id}", userGetMockResponse).Methods("GET")
+	handler.HandleFunc("/aas/users/{id}", userDeleteMockResponse).Methods("DELETE")
+	handler.HandleFunc("/aas/roles/{id}", roleGetMockResponse).Methods("GET")
+	handler.HandleFunc("/aas/roles/{id}", roleDeleteMockResponse).Methods("DELETE")
+	handler.HandleFunc("/aas/users/{id}/roles", userRolesGetMockResponse).Methods("GET")
+	handler.HandleFunc("/aas/users/{id}/permissions", userPermissionsGetMockResponse).Methods("GET")
+	handler.HandleFunc("/aas/users/{id}/roles/{role_id}", userRoleDeleteMockResponse).Methods("DELETE")
 
 	return mockServerLauncher(t, handler)
 }
@@ -53,20 +183,17 @@ func mockServerLauncher(t *testing.T, r http.Handler) (*http.Server, string) {
 	//Listener Implementations
 	listener, err := net.Listen("tcp", ":0")
 	if err != nil {
-		t.Log("mockServerLauncher() : Unable to initiate Listener", err)
+		t.Fatal("mockServerLauncher() : Unable to initiate Listener", err)
 	}
 	port := listener.Addr().(*net.TCPAddr).Port
-	err = listener.Close()
-	if err != nil {
-		t.Log("mockServerLauncher() : Unable to close Listener", err)
-	}
 	portString := fmt.Sprintf(":%d", port)
 
 	h := &http.Server{
 		Addr:    portString,
 		Handler: r,
 	}
-	go h.ListenAndServe()
+	// serve on the already bound listener so that requests issued right after launch are not refused
+	go h.Serve(listener)
 
 	return h, portString
 }
@@ -126,3 +253,258 @@ func TestJWT(t *testing.T) {
 	err = jwt404.FetchAllTokens()
 	assert.Error(t, err, "User token fetch should fail")
 }
+
+func TestFakeJWTTokenProvider(t *testing.T) {
+
+	var jwt JWTTokenProvider = NewFakeJWTTokenProvider()
+	jwt.AddUser("user1", "password")
+
+	_, err := jwt.GetUserToken("user1")
+	assert.True(t, errors.Is(err, ErrJWTNotYetFetched), "token should not be present before fetching")
+
+	ts := NewJWTTokenSource(jwt, "user1")
+	token, err := ts.Token()
+	assert.NoError(t, err, "token source should fetch the token")
+	assert.Equal(t, "fake-token-user1", string(token))
+
+	token, err = jwt.GetUserToken("user1")
+	assert.NoError(t, err, "token should be present after fetching")
+	assert.Equal(t, "fake-token-user1", string(token))
+
+	_, err = jwt.FetchTokenForUser("user2")
+	assert.True(t, errors.Is(err, ErrUserNotFound), "unknown user should not be fetched")
+
+	assert.NoError(t, jwt.UpdateUserPassword("user1", "rotated"))
+	password, _ := jwt.(*FakeJWTTokenProvider).Password("user1")
+	assert.Equal(t, "rotated", password)
+	assert.True(t, errors.Is(jwt.UpdateUserPassword("user2", "password"), ErrUserNotFound))
+	jwt.RemoveUser("user1")
+	_, err = jwt.GetUserToken("user1")
+	assert.True(t, errors.Is(err, ErrUserNotFound), "removed user should be unknown")
+
+	jwt.AddUserWithCredential("user3", CredentialFunc(func() (string, error) {
+		return "", errors.New("vault unavailable")
+	}))
+	_, err = jwt.FetchTokenForUserWithContext(context.Background(), "user3")
+	assert.True(t, errors.Is(err, ErrUserCredential), "credential failure should be reported")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.True(t, errors.Is(jwt.FetchAllTokensWithContext(ctx), context.Canceled))
+
+	_, err = jwt.GetJWTSigningCert()
+	assert.True(t, errors.Is(err, ErrHTTPGetJWTCert), "missing signing certificate should be reported")
+}
+
+func TestJWTConcurrentFetch(t *testing.T) {
+
+	var requests int32
+	handler := mux.NewRouter()
+	handler.HandleFunc("/aas/token", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(50 * time.Millisecond)
+		tokenMockGoodResponse(w, r)
+	}).Methods("POST")
+	aasMockSrv, port := mockServerLauncher(t, handler)
+	defer aasMockSrv.Close()
+
+	jwt := NewJWTClient("http://localhost" + port + "/aas")
+	jwt.HTTPClient = http.DefaultClient
+	jwt.AddUser("user1", "password")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := jwt.FetchTokenForUser("user1")
+			assert.NoError(t, err, "FetchTokenForUser should be successful")
+			assert.Equal(t, aasToken, string(token))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests), "concurrent fetches should be collapsed into one request")
+
+	_, err := jwt.FetchTokenForUser("user1")
+	assert.NoError(t, err, "FetchTokenForUser should be successful")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests), "sequential fetches should request a new token")
+}
+
+func TestJWTFetchAllTokens(t *testing.T) {
+
+	var active, maxActive int32
+	handler := mux.NewRouter()
+	handler.HandleFunc("/aas/token", func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			m := atomic.LoadInt32(&maxActive)
+			if n <= m || atomic.CompareAndSwapInt32(&maxActive, m, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		var cred types.UserCred
+		if err := json.NewDecoder(r.Body).Decode(&cred); err != nil || cred.Password != "password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		tokenMockGoodResponse(w, r)
+	}).Methods("POST")
+	aasMockSrv, port := mockServerLauncher(t, handler)
+	defer aasMockSrv.Close()
+
+	jwt := NewJWTClient("http://localhost" + port + "/aas")
+	jwt.HTTPClient = http.DefaultClient
+	jwt.FetchConcurrency = 3
+	for i := 0; i < 8; i++ {
+		jwt.AddUser(fmt.Sprintf("user%d", i), "password")
+	}
+	jwt.AddUser("bad1", "wrong")
+	jwt.AddUser("bad2", "wrong")
+
+	err := jwt.FetchAllTokens()
+	var fetchErr *FetchAllTokensError
+	assert.True(t, errors.As(err, &fetchErr), "failures should be reported per user")
+	assert.Equal(t, []string{"bad1", "bad2"}, fetchErr.Users())
+	assert.True(t, clients.IsUnauthorized(fetchErr.Errors["bad1"]))
+	assert.True(t, errors.Is(err, ErrHTTPFetchJWTToken))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&maxActive), "fetches should run concurrently up to the limit")
+
+	for i := 0; i < 8; i++ {
+		_, err = jwt.GetUserToken(fmt.Sprintf("user%d", i))
+		assert.NoError(t, err, "tokens of the other users should be fetched")
+	}
+	_, err = jwt.GetUserToken("bad1")
+	assert.True(t, errors.Is(err, ErrJWTNotYetFetched))
+}
+
+func TestJWTFetchCallerContext(t *testing.T) {
+
+	var requests int32
+	handler := mux.NewRouter()
+	handler.HandleFunc("/aas/token", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(200 * time.Millisecond)
+		tokenMockGoodResponse(w, r)
+	}).Methods("POST")
+	aasMockSrv, port := mockServerLauncher(t, handler)
+	defer aasMockSrv.Close()
+
+	jwt := NewJWTClient("http://localhost" + port + "/aas")
+	jwt.HTTPClient = http.DefaultClient
+	jwt.AddUser("user1", "password")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := jwt.FetchTokenForUserWithContext(ctx, "user1")
+		firstErr <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	token, err := jwt.FetchTokenForUserWithContext(context.Background(), "user1")
+	assert.NoError(t, err, "joining caller should not fail with the context of the first caller")
+	assert.Equal(t, aasToken, string(token))
+	assert.True(t, errors.Is(<-firstErr, context.DeadlineExceeded), "first caller should stop waiting at its deadline")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests), "callers should share one request")
+}
+
+// makeTestToken returns an unsigned token expiring after validity
+func makeTestToken(subject string, validity time.Duration) string {
+	enc := base64.RawURLEncoding
+	header := enc.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	claims, _ := json.Marshal(StandardClaims{
+		Subject:   subject,
+		IssuedAt:  time.Now().Unix(),
+		ExpiresAt: time.Now().Add(validity).Unix(),
+	})
+	return header + "." + enc.EncodeToString(claims) + "."
+}
+
+func TestJWTTokenExpiry(t *testing.T) {
+
+	var requests int32
+	var validity int64 = int64(30 * time.Second)
+	handler := mux.NewRouter()
+	handler.HandleFunc("/aas/token", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(makeTestToken("user1", time.Duration(atomic.LoadInt64(&validity)))))
+	}).Methods("POST")
+	aasMockSrv, port := mockServerLauncher(t, handler)
+	defer aasMockSrv.Close()
+
+	jwt := NewJWTClient("http://localhost" + port + "/aas")
+	jwt.HTTPClient = http.DefaultClient
+	jwt.AddUser("user1", "password")
+
+	_, err := jwt.FetchTokenForUser("user1")
+	assert.NoError(t, err, "FetchTokenForUser should be successful")
+	_, err = jwt.GetUserToken("user1")
+	assert.NoError(t, err, "stale token should be fetched again")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests), "token expiring within the default skew should be stale")
+
+	jwt.TokenExpirySkew = 10 * time.Second
+	_, err = jwt.GetUserToken("user1")
+	assert.NoError(t, err, "fresh token should be returned")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests), "token expiring after the skew should be cached")
+
+	var refreshErrors int32
+	jwt.OnRefreshError = func(username string, err error) {
+		atomic.AddInt32(&refreshErrors, 1)
+	}
+	jwt.TokenExpirySkew = time.Second
+	atomic.StoreInt64(&validity, int64(2*time.Second))
+	_, err = jwt.FetchTokenForUser("user1")
+	assert.NoError(t, err, "FetchTokenForUser should be successful")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	jwt.StartRefresher(ctx, 1500*time.Millisecond)
+	deadline := time.Now().Add(3 * time.Second)
+	for atomic.LoadInt32(&requests) < 5 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	cancel()
+	assert.True(t, atomic.LoadInt32(&requests) >= 5, "refresher should renew expiring token")
+	assert.Zero(t, atomic.LoadInt32(&refreshErrors))
+
+	aasMockSrv.Close()
+	jwt.mu.Lock()
+	jwt.tokens["user1"] = &cachedToken{token: []byte("expired"), expiry: time.Now().Add(-time.Second)}
+	jwt.mu.Unlock()
+	_, err = jwt.GetUserToken("user1")
+	assert.Error(t, err, "expired token should not be returned when it can not be renewed")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&refreshErrors), "refresh failure should be reported")
+}
+
+func TestJWTStaleTokenDuringOutage(t *testing.T) {
+
+	var unavailable int32
+	handler := mux.NewRouter()
+	handler.HandleFunc("/aas/token", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&unavailable) != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(makeTestToken("user1", 30*time.Second)))
+	}).Methods("POST")
+	aasMockSrv, port := mockServerLauncher(t, handler)
+	defer aasMockSrv.Close()
+
+	jwt := NewJWTClient("http://localhost" + port + "/aas")
+	jwt.HTTPClient = http.DefaultClient
+	jwt.AddUser("user1", "password")
+	var refreshErr error
+	jwt.OnRefreshError = func(username string, err error) {
+		refreshErr = err
+	}
+
+	fetched, err := jwt.FetchTokenForUser("user1")
+	assert.NoError(t, err)
+	atomic.StoreInt32(&unavailable, 1)
+	token, err := jwt.GetUserToken("user1")
+	assert.NoError(t, err, "token within the skew but not expired should still be returned")
+	assert.Equal(t, fetched, token)
+	assert.True(t, clients.StatusCode(refreshErr) == http.StatusServiceUnavailable, "refresh failure should be reported")
+}
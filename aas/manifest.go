@@ -0,0 +1,347 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package aas
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	types "intel/isecl/lib/common/v5/types/aas"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest describes the desired authorization layout of AAS: the roles that
+// have to exist and the users along with the roles bound to them
+type Manifest struct {
+	Roles []ManifestRole `json:"roles" yaml:"roles"`
+	Users []ManifestUser `json:"users" yaml:"users"`
+}
+
+type ManifestRole struct {
+	types.RoleInfo `yaml:",inline"`
+	Permissions    []string `json:"permissions,omitempty" yaml:"permissions,omitempty"`
+}
+
+// ManifestUser is a user of the manifest. Environment variables referenced as
+// ${VAR} in the password are expanded, so that secrets need not be part of the
+// manifest itself; any other "$" is taken literally. Roles refer to roles declared
+// in the manifest.
+type ManifestUser struct {
+	Name     string           `json:"name" yaml:"name"`
+	Password string           `json:"password" yaml:"password"`
+	Roles    []types.RoleInfo `json:"roles,omitempty" yaml:"roles,omitempty"`
+}
+
+type ChangeAction string
+
+const (
+	ActionNone   ChangeAction = "none"
+	ActionCreate ChangeAction = "create"
+	ActionBind   ChangeAction = "bind"
+)
+
+type ChangeKind string
+
+const (
+	KindRole    ChangeKind = "role"
+	KindUser    ChangeKind = "user"
+	KindBinding ChangeKind = "binding"
+)
+
+// Change is a single step of a Plan. User is set for users and bindings, Role
+// for roles and bindings.
+type Change struct {
+	Action ChangeAction
+	Kind   ChangeKind
+	User   string
+	Role   types.RoleInfo
+}
+
+func (ch Change) String() string {
+	switch ch.Kind {
+	case KindRole:
+		return "role " + roleName(ch.Role)
+	case KindUser:
+		return "user " + ch.User
+	default:
+		return "binding " + ch.User + " -> " + roleName(ch.Role)
+	}
+}
+
+// Plan is the difference between a manifest and the live state of AAS. It lists
+// all of the roles, users and bindings of the manifest, in the order Apply
+// processes them, with ActionNone for the ones already in place.
+type Plan struct {
+	Changes  []Change
+	manifest *Manifest
+}
+
+func roleName(r types.RoleInfo) string {
+	if r.Context == "" {
+		return r.Service + ":" + r.Name
+	}
+	return r.Service + ":" + r.Name + ":" + r.Context
+}
+
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandPassword replaces the ${VAR} references in password with the values of the
+// environment variables, which have to be set
+func expandPassword(password string) (string, error) {
+
+	var err error
+	expanded := envReference.ReplaceAllStringFunc(password, func(ref string) string {
+		name := envReference.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value
+	})
+	return expanded, err
+}
+
+// ParseManifest parses a manifest in YAML or JSON format
+func ParseManifest(data []byte) (*Manifest, error) {
+
+	var m Manifest
+	err := yaml.Unmarshal(data, &m)
+	if err != nil {
+		return nil, fmt.Errorf("aas.ParseManifest: failed to parse manifest: %w", err)
+	}
+	for i := range m.Users {
+		m.Users[i].Password, err = expandPassword(m.Users[i].Password)
+		if err != nil {
+			return nil, fmt.Errorf("aas.ParseManifest: password of user %s: %w", m.Users[i].Name, err)
+		}
+	}
+	return &m, m.Validate()
+}
+
+// LoadManifest reads and parses the manifest in file path
+func LoadManifest(path string) (*Manifest, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseManifest(data)
+}
+
+// Validate checks that all roles and users are named, none of them is declared twice
+// and that the roles bound to users are declared in the manifest
+func (m *Manifest) Validate() error {
+
+	roles := make(map[types.RoleInfo]bool, len(m.Roles))
+	for _, r := range m.Roles {
+		if r.Service == "" || r.Name == "" {
+			return fmt.Errorf("aas.Manifest: role without service or name: %q", roleName(r.RoleInfo))
+		}
+		if roles[r.RoleInfo] {
+			return fmt.Errorf("aas.Manifest: role declared twice: %s", roleName(r.RoleInfo))
+		}
+		roles[r.RoleInfo] = true
+	}
+	users := make(map[string]bool, len(m.Users))
+	for _, u := range m.Users {
+		if u.Name == "" {
+			return fmt.Errorf("aas.Manifest: user without name")
+		}
+		if users[u.Name] {
+			return fmt.Errorf("aas.Manifest: user declared twice: %s", u.Name)
+		}
+		users[u.Name] = true
+		for _, r := range u.Roles {
+			if !roles[r] {
+				return fmt.Errorf("aas.Manifest: role %s of user %s is not declared", roleName(r), u.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// Plan computes the changes needed to bring AAS in line with the manifest without
+// modifying anything
+func (c *Client) Plan(m *Manifest) (*Plan, error) {
+	return c.PlanWithContext(context.Background(), m)
+}
+
+func (c *Client) PlanWithContext(ctx context.Context, m *Manifest) (*Plan, error) {
+
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	plan := Plan{manifest: m}
+	roleIDs := make(map[types.RoleInfo]string, len(m.Roles))
+	for _, r := range m.Roles {
+		role, err := c.findRole(ctx, r.RoleInfo)
+		if err != nil {
+			return nil, err
+		}
+		change := Change{Action: ActionCreate, Kind: KindRole, Role: r.RoleInfo}
+		if role != nil {
+			change.Action = ActionNone
+			roleIDs[r.RoleInfo] = role.ID
+		}
+		plan.Changes = append(plan.Changes, change)
+	}
+
+	var bindings []Change
+	for _, u := range m.Users {
+		user, err := c.findUser(ctx, u.Name)
+		if err != nil {
+			return nil, err
+		}
+		change := Change{Action: ActionCreate, Kind: KindUser, User: u.Name}
+		bound := make(map[string]bool)
+		if user != nil {
+			change.Action = ActionNone
+			roles, err := c.GetRolesForUserWithContext(ctx, user.ID)
+			if err != nil {
+				return nil, err
+			}
+			for _, r := range roles {
+				bound[r.ID] = true
+			}
+		}
+		plan.Changes = append(plan.Changes, change)
+
+		for _, r := range u.Roles {
+			binding := Change{Action: ActionBind, Kind: KindBinding, User: u.Name, Role: r}
+			if id, ok := roleIDs[r]; ok && bound[id] {
+				binding.Action = ActionNone
+			}
+			bindings = append(bindings, binding)
+		}
+	}
+	plan.Changes = append(plan.Changes, bindings...)
+	return &plan, nil
+}
+
+// HasChanges reports whether applying the plan would modify AAS
+func (p *Plan) HasChanges() bool {
+	for _, ch := range p.Changes {
+		if ch.Action != ActionNone {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteDiff writes a human readable description of the plan to w, one line per
+// change. Created objects are marked with '+', bindings with '~' and objects
+// already in place with ' '.
+func (p *Plan) WriteDiff(w io.Writer) error {
+
+	counts := make(map[ChangeAction]int)
+	for _, ch := range p.Changes {
+		marker := " "
+		switch ch.Action {
+		case ActionCreate:
+			marker = "+"
+		case ActionBind:
+			marker = "~"
+		}
+		counts[ch.Action]++
+		if _, err := fmt.Fprintf(w, "%s %s\n", marker, ch); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "Plan: %d to create, %d to bind, %d unchanged\n",
+		counts[ActionCreate], counts[ActionBind], counts[ActionNone])
+	return err
+}
+
+func (p *Plan) String() string {
+	var sb strings.Builder
+	_ = p.WriteDiff(&sb)
+	return sb.String()
+}
+
+// Apply carries out the changes of the plan. Objects are ensured rather than blindly
+// created, so changes made to AAS after planning do not make Apply fail.
+func (c *Client) Apply(p *Plan) error {
+	return c.ApplyWithContext(context.Background(), p)
+}
+
+func (c *Client) ApplyWithContext(ctx context.Context, p *Plan) error {
+
+	m := p.manifest
+	if m == nil {
+		return fmt.Errorf("aas.Apply: plan was not computed by Client.Plan")
+	}
+	roles := make(map[types.RoleInfo]ManifestRole, len(m.Roles))
+	for _, r := range m.Roles {
+		roles[r.RoleInfo] = r
+	}
+	users := make(map[string]ManifestUser, len(m.Users))
+	for _, u := range m.Users {
+		users[u.Name] = u
+	}
+
+	roleIDs := make(map[types.RoleInfo]string)
+	userIDs := make(map[string]string)
+	bindings := make(map[string][]string)
+	var order []string
+	for _, ch := range p.Changes {
+		if ch.Action == ActionNone {
+			continue
+		}
+		switch ch.Kind {
+		case KindRole:
+			r := roles[ch.Role]
+			role, _, err := c.EnsureRoleWithContext(ctx, types.RoleCreate{RoleInfo: r.RoleInfo, Permissions: r.Permissions})
+			if err != nil {
+				return fmt.Errorf("aas.Apply: %s: %w", ch, err)
+			}
+			roleIDs[ch.Role] = role.ID
+		case KindUser:
+			u := users[ch.User]
+			user, _, err := c.EnsureUserWithContext(ctx, types.UserCreate{Name: u.Name, Password: u.Password})
+			if err != nil {
+				return fmt.Errorf("aas.Apply: %s: %w", ch, err)
+			}
+			userIDs[ch.User] = user.ID
+		case KindBinding:
+			if _, ok := roleIDs[ch.Role]; !ok {
+				role, err := c.findRole(ctx, ch.Role)
+				if err != nil {
+					return fmt.Errorf("aas.Apply: %s: %w", ch, err)
+				}
+				if role == nil {
+					return fmt.Errorf("aas.Apply: %s: role not found", ch)
+				}
+				roleIDs[ch.Role] = role.ID
+			}
+			if _, ok := bindings[ch.User]; !ok {
+				order = append(order, ch.User)
+			}
+			bindings[ch.User] = append(bindings[ch.User], roleIDs[ch.Role])
+		}
+	}
+
+	for _, name := range order {
+		if _, ok := userIDs[name]; !ok {
+			user, err := c.findUser(ctx, name)
+			if err != nil {
+				return fmt.Errorf("aas.Apply: binding roles to user %s: %w", name, err)
+			}
+			if user == nil {
+				return fmt.Errorf("aas.Apply: binding roles to user %s: user not found", name)
+			}
+			userIDs[name] = user.ID
+		}
+		if _, err := c.bindRoles(ctx, userIDs[name], bindings[name]); err != nil {
+			return fmt.Errorf("aas.Apply: binding roles to user %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package aas
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testManifest = `
+roles:
+  - service: TA
+    name: Administrator
+    permissions: ["*:*:*"]
+  - service: CMS
+    name: CertApprover
+    context: CN=Trust Agent TLS Certificate;SAN=ta.example.com;CERTTYPE=TLS
+users:
+  - name: ta_service
+    password: ${TEST_TA_SERVICE_PASSWORD}
+    roles:
+      - service: TA
+        name: Administrator
+      - service: CMS
+        name: CertApprover
+        context: CN=Trust Agent TLS Certificate;SAN=ta.example.com;CERTTYPE=TLS
+`
+
+func TestParseManifest(t *testing.T) {
+
+	os.Setenv("TEST_TA_SERVICE_PASSWORD", "secret")
+	defer os.Unsetenv("TEST_TA_SERVICE_PASSWORD")
+
+	m, err := ParseManifest([]byte(testManifest))
+	assert.NoError(t, err, "YAML manifest should be parsed")
+	assert.Len(t, m.Roles, 2)
+	assert.Equal(t, []string{"*:*:*"}, m.Roles[0].Permissions)
+	assert.Equal(t, "secret", m.Users[0].Password)
+
+	m, err = ParseManifest([]byte(`{"roles": [{"service": "TA", "name": "Administrator"}],
+		"users": [{"name": "ta_service", "roles": [{"service": "TA", "name": "Administrator"}]}]}`))
+	assert.NoError(t, err, "JSON manifest should be parsed")
+	assert.Equal(t, "Administrator", m.Users[0].Roles[0].Name)
+
+	_, err = ParseManifest([]byte(`{"users": [{"name": "ta_service", "roles": [{"service": "TA", "name": "Administrator"}]}]}`))
+	assert.Error(t, err, "manifest binding undeclared role should be rejected")
+
+	m, err = ParseManifest([]byte("users:\n  - name: ta_service\n    password: 'pa$$w0rd$HOME'\n"))
+	assert.NoError(t, err, "password with literal $ should be parsed")
+	assert.Equal(t, "pa$$w0rd$HOME", m.Users[0].Password, "only ${VAR} references should be expanded")
+
+	m, err = ParseManifest([]byte("users:\n  - name: ta_service\n    password: 'pre-${TEST_TA_SERVICE_PASSWORD}'\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "pre-secret", m.Users[0].Password)
+
+	_, err = ParseManifest([]byte("users:\n  - name: ta_service\n    password: ${TEST_UNSET_SECRET}\n"))
+	assert.Error(t, err, "reference to unset environment variable should be rejected")
+}
+
+func TestManifestPlanApply(t *testing.T) {
+
+	os.Setenv("TEST_TA_SERVICE_PASSWORD", "secret")
+	defer os.Unsetenv("TEST_TA_SERVICE_PASSWORD")
+	aasMockSrv, port, store := aasStatefulMockServer(t)
+	defer aasMockSrv.Close()
+
+	aasClient := Client{
+		BaseURL:    "http://localhost" + port + "/aas",
+		JWTToken:   []byte(aasToken),
+		HTTPClient: http.DefaultClient,
+	}
+
+	m, err := ParseManifest([]byte(testManifest))
+	assert.NoError(t, err, "manifest should be parsed")
+
+	plan, err := aasClient.Plan(m)
+	assert.NoError(t, err, "plan should be computed")
+	assert.True(t, plan.HasChanges())
+	assert.Empty(t, store.users, "planning should not create anything")
+	diff := plan.String()
+	assert.True(t, strings.Contains(diff, "+ role TA:Administrator\n"), diff)
+	assert.True(t, strings.Contains(diff, "~ binding ta_service -> TA:Administrator\n"), diff)
+	assert.True(t, strings.HasSuffix(diff, "Plan: 3 to create, 2 to bind, 0 unchanged\n"), diff)
+
+	err = aasClient.Apply(plan)
+	assert.NoError(t, err, "plan should be applied")
+	assert.Len(t, store.users, 1)
+	assert.Len(t, store.roles, 2)
+	for id := range store.users {
+		assert.Len(t, store.bindings[id], 2)
+	}
+
+	plan, err = aasClient.Plan(m)
+	assert.NoError(t, err, "plan should be computed")
+	assert.False(t, plan.HasChanges(), plan.String())
+}
+
+func TestManifestApplyBindingConflict(t *testing.T) {
+
+	os.Setenv("TEST_TA_SERVICE_PASSWORD", "secret")
+	defer os.Unsetenv("TEST_TA_SERVICE_PASSWORD")
+	aasMockSrv, port, store := aasStatefulMockServer(t)
+	defer aasMockSrv.Close()
+	store.partialConflict = true
+
+	aasClient := Client{
+		BaseURL:    "http://localhost" + port + "/aas",
+		JWTToken:   []byte(aasToken),
+		HTTPClient: http.DefaultClient,
+	}
+	m, err := ParseManifest([]byte(testManifest))
+	assert.NoError(t, err, "manifest should be parsed")
+
+	plan, err := aasClient.Plan(m)
+	assert.NoError(t, err, "plan should be computed")
+	err = aasClient.Apply(plan)
+	assert.NoError(t, err, "roles missing after a conflict should be bound")
+	for id := range store.users {
+		assert.Len(t, store.bindings[id], 2, "all of the roles should be bound")
+	}
+
+	m.Users[0].Name = "wls_service"
+	plan, err = aasClient.Plan(m)
+	assert.NoError(t, err, "plan should be computed")
+	store.mu.Lock()
+	store.rejectBinds = true
+	store.mu.Unlock()
+	err = aasClient.Apply(plan)
+	assert.Error(t, err, "roles still unbound after a conflict should be reported")
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package aas
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	commContext "intel/isecl/lib/common/v5/context"
+	types "intel/isecl/lib/common/v5/types/aas"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// TokenVerifier verifies AAS tokens and returns their claims, it is implemented by JWTVerifier
+// and JWTCertCache
+type TokenVerifier interface {
+	VerifyClaims(token []byte) (*Claims, error)
+}
+
+type claimsContextKey struct{}
+
+// ClaimsFromContext returns the claims of the token the request was authenticated with by
+// the middleware returned by NewAuthMiddleware
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*Claims)
+	return claims, ok
+}
+
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="AAS"`)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+func forbidden(w http.ResponseWriter) {
+	http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+}
+
+// NewAuthMiddleware returns a middleware authenticating requests with the bearer token in
+// their Authorization header. Requests without a valid token are rejected with 401
+// Unauthorized. The claims of the token are attached to the request context, where they
+// can be retrieved with ClaimsFromContext, along with the roles, permissions and subject
+// as set by the context package of the common library.
+func NewAuthMiddleware(v TokenVerifier) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if len(authHeader) < 7 || !strings.EqualFold(authHeader[:7], "Bearer ") {
+				log.Debug("aas/middleware: request without bearer token rejected")
+				unauthorized(w)
+				return
+			}
+			claims, err := v.VerifyClaims([]byte(strings.TrimSpace(authHeader[7:])))
+			if err != nil {
+				log.WithError(err).Debug("aas/middleware: request with invalid token rejected")
+				unauthorized(w)
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), claimsContextKey{}, claims))
+			r = commContext.SetUserRoles(r, claims.Roles)
+			r = commContext.SetUserPermissions(r, claims.Permissions)
+			r = commContext.SetTokenSubject(r, claims.Subject)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authorize returns a middleware rejecting requests whose claims are not accepted by
+// allowed with 403 Forbidden. It has to be used behind the middleware of NewAuthMiddleware.
+func authorize(allowed func(*Claims) bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				unauthorized(w)
+				return
+			}
+			if !allowed(claims) {
+				log.Debugf("aas/middleware: request of %s to %s rejected, insufficient privileges", claims.Subject, r.URL.Path)
+				forbidden(w)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRoles returns a middleware admitting requests whose token has at least one of roles.
+// The context of the roles is not taken into account.
+func RequireRoles(roles ...types.RoleInfo) mux.MiddlewareFunc {
+	return authorize(func(claims *Claims) bool {
+		for _, role := range roles {
+			if claims.HasRole(role.Service, role.Name) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// RequirePermissions returns a middleware admitting requests whose token grants all of
+// permissions on service
+func RequirePermissions(service string, permissions ...string) mux.MiddlewareFunc {
+	return authorize(func(claims *Claims) bool {
+		for _, permission := range permissions {
+			if !claims.HasPermission(service, permission) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// PermissionHandler wraps h to be served only for requests whose token grants all of
+// permissions on service, e.g.
+//
+//	router.Handle("/flavors", aas.PermissionHandler(createFlavor, "VS", "flavors:create:*")).Methods("POST")
+func PermissionHandler(h http.HandlerFunc, service string, permissions ...string) http.Handler {
+	return RequirePermissions(service, permissions...)(h)
+}
+
+// RoleHandler wraps h to be served only for requests whose token has one of roles
+func RoleHandler(h http.HandlerFunc, roles ...types.RoleInfo) http.Handler {
+	return RequireRoles(roles...)(h)
+}
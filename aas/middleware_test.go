@@ -0,0 +1,72 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package aas
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	commContext "intel/isecl/lib/common/v5/context"
+	types "intel/isecl/lib/common/v5/types/aas"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+
+	pki := newTestPKI(t)
+	jwt := NewFakeJWTTokenProvider()
+	jwt.SigningCert = pki.signingPEM
+	v, err := FetchJWTVerifier(jwt, pki.rootCAPEM)
+	assert.NoError(t, err, "verifier should be created from the AAS signing certificates")
+
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		claims, found := ClaimsFromContext(r.Context())
+		subject, _ := commContext.GetTokenSubject(r)
+		if !found || subject != claims.Subject {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	router := mux.NewRouter()
+	router.Use(NewAuthMiddleware(v))
+	router.Handle("/flavors", PermissionHandler(ok, "VS", "flavors:create:*")).Methods("POST")
+	router.Handle("/hosts", RoleHandler(ok, types.RoleInfo{Service: "VS", Name: "Administrator"})).Methods("GET")
+
+	claims := validTestClaims()
+	claims.Permissions = []types.PermissionInfo{{Service: "VS", Rules: []string{"flavors:*:*"}}}
+	token := pki.signToken(t, "RS384", claims)
+
+	expired := validTestClaims()
+	expired.ExpiresAt = 1
+	expiredToken := pki.signToken(t, "RS384", expired)
+
+	tests := []struct {
+		method string
+		path   string
+		token  []byte
+		status int
+	}{
+		{http.MethodPost, "/flavors", token, http.StatusOK},
+		{http.MethodPost, "/flavors", nil, http.StatusUnauthorized},
+		{http.MethodPost, "/flavors", expiredToken, http.StatusUnauthorized},
+		{http.MethodPost, "/flavors", []byte(aasToken), http.StatusUnauthorized},
+		{http.MethodGet, "/hosts", token, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		if test.token != nil {
+			req.Header.Set("Authorization", "Bearer "+string(test.token))
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, test.status, rec.Code, test.method+" "+test.path)
+		if test.status == http.StatusUnauthorized {
+			assert.NotEmpty(t, rec.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package aas
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var ErrMalformedToken = errors.New("Malformed JWT token")
+
+// StandardClaims are the registered claims of the tokens issued by AAS
+type StandardClaims struct {
+	Issuer    string `json:"iss,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	ID        string `json:"jti,omitempty"`
+}
+
+// ExpiryTime returns the time the token expires at, or the zero time if it has no exp claim
+func (sc *StandardClaims) ExpiryTime() time.Time {
+	if sc.ExpiresAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sc.ExpiresAt, 0)
+}
+
+// IssueTime returns the time the token was issued at, or the zero time if it has no iat claim
+func (sc *StandardClaims) IssueTime() time.Time {
+	if sc.IssuedAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sc.IssuedAt, 0)
+}
+
+// splitToken returns the decoded header and payload of a JWT token along with its
+// signing input and signature. The signature is not verified.
+func splitToken(token []byte) (header, payload, signingInput, signature []byte, err error) {
+
+	token = bytes.TrimSpace(token)
+	parts := bytes.Split(token, []byte("."))
+	if len(parts) != 3 {
+		return nil, nil, nil, nil, ErrMalformedToken
+	}
+	enc := base64.RawURLEncoding
+	header, err = enc.DecodeString(string(bytes.TrimRight(parts[0], "=")))
+	if err != nil {
+		return nil, nil, nil, nil, ErrMalformedToken
+	}
+	payload, err = enc.DecodeString(string(bytes.TrimRight(parts[1], "=")))
+	if err != nil {
+		return nil, nil, nil, nil, ErrMalformedToken
+	}
+	signature, err = enc.DecodeString(string(bytes.TrimRight(parts[2], "=")))
+	if err != nil {
+		return nil, nil, nil, nil, ErrMalformedToken
+	}
+	signingInput = token[:len(parts[0])+1+len(parts[1])]
+	return header, payload, signingInput, signature, nil
+}
+
+// parseStandardClaims returns the registered claims of token without verifying its signature
+func parseStandardClaims(token []byte) (*StandardClaims, error) {
+
+	_, payload, _, _, err := splitToken(token)
+	if err != nil {
+		return nil, err
+	}
+	var sc StandardClaims
+	if err = json.Unmarshal(payload, &sc); err != nil {
+		return nil, ErrMalformedToken
+	}
+	return &sc, nil
+}
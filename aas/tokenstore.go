@@ -0,0 +1,207 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package aas
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TokenStore persists the tokens fetched by jwtClient, so that they can be reused by other
+// processes until they expire. jwtClient stores the tokens under a key made of the URL of
+// AAS and the user name, see TokenStoreKey.
+type TokenStore interface {
+	// Load returns the token stored under key, or nil if there is none
+	Load(key string) ([]byte, error)
+	Save(key string, token []byte) error
+	Delete(key string) error
+}
+
+// TokenStoreKey returns the key the token of username issued by the AAS at baseURL is
+// stored under, so that clients of different AAS instances sharing a store do not reuse
+// each other's tokens
+func TokenStoreKey(baseURL, username string) string {
+	return strings.TrimSuffix(baseURL, "/") + "\x00" + username
+}
+
+// TokenStoreKeySize is the size of the AES-256 key the tokens are encrypted with
+const TokenStoreKeySize = 32
+
+var ErrTokenStoreKeyInvalid = errors.New("Token store key has to be 32 bytes, base64 encoded")
+
+// FileTokenStore is a TokenStore keeping the tokens of all users in a single file, encrypted
+// with AES-GCM. The file is created with mode 0600. Access from concurrent processes is
+// serialized with an advisory lock on the file path with the ".lock" suffix, on Windows
+// access is only serialized within the process.
+type FileTokenStore struct {
+	path string
+	aead cipher.AEAD
+}
+
+// DecodeTokenStoreKey decodes a base64 encoded token store key
+func DecodeTokenStoreKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != TokenStoreKeySize {
+		return nil, ErrTokenStoreKeyInvalid
+	}
+	return key, nil
+}
+
+// TokenStoreKeyFromFile reads the base64 encoded token store key from the file path
+func TokenStoreKeyFromFile(path string) ([]byte, error) {
+	encoded, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeTokenStoreKey(string(encoded))
+}
+
+// TokenStoreKeyFromEnv reads the base64 encoded token store key from the environment
+// variable name
+func TokenStoreKeyFromEnv(name string) ([]byte, error) {
+	encoded, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, errors.New("aas.TokenStoreKeyFromEnv: environment variable " + name + " is not set")
+	}
+	return DecodeTokenStoreKey(encoded)
+}
+
+// NewFileTokenStore returns a token store persisting the tokens to the file path, encrypted
+// with key
+func NewFileTokenStore(path string, key []byte) (*FileTokenStore, error) {
+
+	if len(key) != TokenStoreKeySize {
+		return nil, ErrTokenStoreKeyInvalid
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &FileTokenStore{path: path, aead: aead}, nil
+}
+
+// read returns the decrypted tokens of the store file, which are empty if it does not exist
+func (s *FileTokenStore) read() (map[string]string, error) {
+
+	tokens := make(map[string]string)
+	sealed, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return tokens, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	nonceSize := s.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, errors.New("aas.FileTokenStore: token store file is corrupted")
+	}
+	plain, err := s.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return nil, errors.New("aas.FileTokenStore: failed to decrypt token store file: " + err.Error())
+	}
+	if err = json.Unmarshal(plain, &tokens); err != nil {
+		return nil, errors.New("aas.FileTokenStore: token store file is corrupted")
+	}
+	return tokens, nil
+}
+
+// write encrypts tokens and replaces the store file with them atomically
+func (s *FileTokenStore) write(tokens map[string]string) error {
+
+	plain, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	sealed := s.aead.Seal(nonce, nonce, plain, nil)
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err = tmp.Chmod(0600); err == nil {
+		_, err = tmp.Write(sealed)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// update applies modify to the tokens of the store under the exclusive lock. A store file
+// that can not be decrypted, e.g. after the key was changed, is started over.
+func (s *FileTokenStore) update(modify func(tokens map[string]string)) error {
+
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	tokens, err := s.read()
+	if err != nil {
+		tokens = make(map[string]string)
+	}
+	modify(tokens)
+	return s.write(tokens)
+}
+
+func (s *FileTokenStore) Load(key string) ([]byte, error) {
+
+	unlock, err := s.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	tokens, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	if token, ok := tokens[key]; ok {
+		return []byte(token), nil
+	}
+	return nil, nil
+}
+
+// Save stores token under key. Expired tokens stored under other keys are dropped.
+func (s *FileTokenStore) Save(key string, token []byte) error {
+	return s.update(func(tokens map[string]string) {
+		for k, t := range tokens {
+			if sc, err := parseStandardClaims([]byte(t)); err != nil || (sc.ExpiresAt != 0 && time.Now().After(sc.ExpiryTime())) {
+				delete(tokens, k)
+			}
+		}
+		tokens[key] = string(token)
+	})
+}
+
+func (s *FileTokenStore) Delete(key string) error {
+	return s.update(func(tokens map[string]string) {
+		delete(tokens, key)
+	})
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package aas
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTokenStoreKey(t *testing.T) []byte {
+	key := make([]byte, TokenStoreKeySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal("failed to generate key: ", err)
+	}
+	return key
+}
+
+func TestFileTokenStore(t *testing.T) {
+
+	key := newTestTokenStoreKey(t)
+	path := filepath.Join(t.TempDir(), "tokens")
+	store, err := NewFileTokenStore(path, key)
+	assert.NoError(t, err)
+
+	token, err := store.Load("user1")
+	assert.NoError(t, err, "missing store file should not be an error")
+	assert.Nil(t, token)
+
+	token1 := []byte(makeTestToken("user1", time.Hour))
+	assert.NoError(t, store.Save("user1", token1))
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "store file should only be accessible by the owner")
+	raw, _ := ioutil.ReadFile(path)
+	assert.False(t, bytes.Contains(raw, []byte("user1")), "store file should be encrypted")
+
+	token, err = store.Load("user1")
+	assert.NoError(t, err)
+	assert.Equal(t, token1, token)
+
+	assert.NoError(t, store.Save("expired", []byte(makeTestToken("expired", -time.Hour))))
+	assert.NoError(t, store.Save("user2", []byte(makeTestToken("user2", time.Hour))))
+	token, _ = store.Load("expired")
+	assert.Nil(t, token, "expired tokens should be dropped")
+	assert.NoError(t, store.Delete("user1"))
+	token, _ = store.Load("user1")
+	assert.Nil(t, token, "deleted token should be gone")
+
+	otherStore, _ := NewFileTokenStore(path, newTestTokenStoreKey(t))
+	_, err = otherStore.Load("user2")
+	assert.Error(t, err, "store file should not be decrypted with another key")
+
+	_, err = NewFileTokenStore(path, key[:16])
+	assert.Equal(t, ErrTokenStoreKeyInvalid, err)
+
+	os.Setenv("AAS_TEST_TOKEN_STORE_KEY", base64.StdEncoding.EncodeToString(key))
+	defer os.Unsetenv("AAS_TEST_TOKEN_STORE_KEY")
+	envKey, err := TokenStoreKeyFromEnv("AAS_TEST_TOKEN_STORE_KEY")
+	assert.NoError(t, err)
+	assert.Equal(t, key, envKey)
+	keyPath := filepath.Join(t.TempDir(), "key")
+	_ = ioutil.WriteFile(keyPath, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600)
+	fileKey, err := TokenStoreKeyFromFile(keyPath)
+	assert.NoError(t, err)
+	assert.Equal(t, key, fileKey)
+}
+
+func TestFileTokenStoreConcurrentSave(t *testing.T) {
+
+	key := newTestTokenStoreKey(t)
+	path := filepath.Join(t.TempDir(), "tokens")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// a store per goroutine, as separate processes would have
+			store, _ := NewFileTokenStore(path, key)
+			username := fmt.Sprintf("user%d", i)
+			assert.NoError(t, store.Save(username, []byte(makeTestToken(username, time.Hour))))
+		}(i)
+	}
+	wg.Wait()
+
+	store, _ := NewFileTokenStore(path, key)
+	for i := 0; i < 10; i++ {
+		token, err := store.Load(fmt.Sprintf("user%d", i))
+		assert.NoError(t, err)
+		assert.NotNil(t, token, "no save should be lost")
+	}
+}
+
+func TestJWTTokenStore(t *testing.T) {
+
+	var requests int32
+	handler := mux.NewRouter()
+	handler.HandleFunc("/aas/token", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(makeTestToken("user1", time.Hour)))
+	}).Methods("POST")
+	aasMockSrv, port := mockServerLauncher(t, handler)
+	defer aasMockSrv.Close()
+
+	store, err := NewFileTokenStore(filepath.Join(t.TempDir(), "tokens"), newTestTokenStoreKey(t))
+	assert.NoError(t, err)
+	newClient := func() *jwtClient {
+		jwt := NewJWTClient("http://localhost" + port + "/aas")
+		jwt.HTTPClient = http.DefaultClient
+		jwt.TokenStore = store
+		jwt.AddUser("user1", "password")
+		return jwt
+	}
+
+	first := newClient()
+	assert.NoError(t, first.FetchAllTokens())
+	token, err := first.GetUserToken("user1")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	second := newClient()
+	assert.NoError(t, second.FetchAllTokens())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests), "stored token should not be fetched again")
+	stored, err := newClient().GetUserToken("user1")
+	assert.NoError(t, err, "stored token should be reused")
+	assert.Equal(t, token, stored)
+
+	otherAAS := NewJWTClient("http://127.0.0.1" + port + "/aas")
+	otherAAS.HTTPClient = http.DefaultClient
+	otherAAS.TokenStore = store
+	otherAAS.AddUser("user1", "password")
+	_, err = otherAAS.GetUserToken("user1")
+	assert.True(t, errors.Is(err, ErrJWTNotYetFetched), "token of another AAS should not be reused")
+	assert.NoError(t, otherAAS.FetchAllTokens())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests), "token should be fetched from the other AAS")
+
+	second.RemoveUser("user1")
+	third := newClient()
+	_, err = third.GetUserToken("user1")
+	assert.Error(t, err, "token of removed user should be deleted from the store")
+}
@@ -0,0 +1,43 @@
+//go:build windows
+// +build windows
+
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+
+package aas
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+var (
+	storeLocksMu sync.Mutex
+	storeLocks   = make(map[string]*sync.RWMutex)
+)
+
+// lock takes the lock of the store, exclusive or shared, and returns the function releasing
+// it. The lock is held in memory, so it only serializes the stores of the same file within
+// the process.
+func (s *FileTokenStore) lock(exclusive bool) (func(), error) {
+
+	path, err := filepath.Abs(s.path)
+	if err != nil {
+		return nil, err
+	}
+	storeLocksMu.Lock()
+	l, ok := storeLocks[path]
+	if !ok {
+		l = &sync.RWMutex{}
+		storeLocks[path] = l
+	}
+	storeLocksMu.Unlock()
+	if exclusive {
+		l.Lock()
+		return l.Unlock, nil
+	}
+	l.RLock()
+	return l.RUnlock, nil
+}
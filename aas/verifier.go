@@ -0,0 +1,219 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package aas
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNoValidJWTSigningCert = errors.New("No valid JWT signing certificate chaining to the root CA")
+	ErrTokenKeyIDMissing     = errors.New("JWT token has no key ID (kid) in its header")
+	ErrTokenAlgUnsupported   = &JWTClientErr{
+		ErrMessage: "JWT token signing algorithm not supported",
+	}
+	ErrTokenUnknownKeyID = &JWTClientErr{
+		ErrMessage: "No JWT signing certificate matching token key ID",
+	}
+	ErrTokenSignatureInvalid = errors.New("JWT token signature is invalid")
+	ErrTokenExpired          = errors.New("JWT token is expired")
+	ErrTokenExpiryMissing    = errors.New("JWT token has no expiry (exp)")
+	ErrTokenNotYetValid      = errors.New("JWT token is not valid yet")
+	ErrJWTSigningCertExpired = errors.New("JWT signing certificate of the token is expired")
+	ErrTokenIssuerInvalid    = &JWTClientErr{
+		ErrMessage: "JWT token issuer is not accepted",
+	}
+)
+
+// JWTVerifier verifies the signature and validity of AAS tokens locally, using the JWT
+// signing certificates of AAS. The certificate is selected by the key ID (kid) in the token
+// header, which is the hex encoded SHA-1 digest of the certificate.
+//
+// Tokens without expiry (exp) are rejected. The issuer (iss) is checked when Issuer is not
+// empty. Leeway is the clock skew tolerated when checking the expiry (exp) and not before
+// (nbf) times.
+type JWTVerifier struct {
+	Issuer string
+	Leeway time.Duration
+
+	certs map[string]*x509.Certificate
+}
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// KeyID returns the key ID AAS puts into the header of the tokens signed with cert
+func KeyID(cert *x509.Certificate) string {
+	digest := sha1.Sum(cert.Raw)
+	return hex.EncodeToString(digest[:])
+}
+
+// parseCertificates returns all certificates of a PEM bundle
+func parseCertificates(pemBytes []byte) ([]*x509.Certificate, error) {
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, pemBytes = pem.Decode(pemBytes)
+		if block == nil {
+			return certs, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+}
+
+// NewJWTVerifier returns a verifier for the tokens signed with the JWT signing certificates
+// in signingCertsPEM, the bundle returned by GetJWTSigningCert. CA certificates of the bundle
+// are used as intermediates, signing certificates that are expired or do not chain to one of
+// the root CAs in rootCAsPEM, i.e. the CMS root CA, are skipped.
+func NewJWTVerifier(signingCertsPEM, rootCAsPEM []byte) (*JWTVerifier, error) {
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(rootCAsPEM) {
+		return nil, errors.New("aas.NewJWTVerifier: no root CA certificate found")
+	}
+	certs, err := parseCertificates(signingCertsPEM)
+	if err != nil {
+		return nil, errors.New("aas.NewJWTVerifier: failed to parse JWT signing certificates: " + err.Error())
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs {
+		if cert.IsCA {
+			intermediates.AddCert(cert)
+		}
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+
+	v := JWTVerifier{certs: make(map[string]*x509.Certificate)}
+	for _, cert := range certs {
+		if cert.IsCA {
+			continue
+		}
+		if _, ok := cert.PublicKey.(*rsa.PublicKey); !ok {
+			continue
+		}
+		if _, err := cert.Verify(opts); err != nil {
+			continue
+		}
+		v.certs[KeyID(cert)] = cert
+	}
+	if len(v.certs) == 0 {
+		return nil, ErrNoValidJWTSigningCert
+	}
+	return &v, nil
+}
+
+// FetchJWTVerifier retrieves the JWT signing certificates from AAS and returns a verifier
+// for the tokens signed with them
+func FetchJWTVerifier(jwt JWTTokenProvider, rootCAsPEM []byte) (*JWTVerifier, error) {
+
+	signingCertsPEM, err := jwt.GetJWTSigningCert()
+	if err != nil {
+		return nil, err
+	}
+	return NewJWTVerifier(signingCertsPEM, rootCAsPEM)
+}
+
+// KeyIDs returns the key IDs of the signing certificates known to the verifier
+func (v *JWTVerifier) KeyIDs() []string {
+	ids := make([]string, 0, len(v.certs))
+	for id := range v.certs {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Verify checks the signature, the validity period and the issuer of token and returns its
+// registered claims. When claims is not nil, all claims of the token are decoded into it.
+func (v *JWTVerifier) Verify(token []byte, claims interface{}) (*StandardClaims, error) {
+
+	headerBytes, payload, signingInput, signature, err := splitToken(token)
+	if err != nil {
+		return nil, err
+	}
+	var header tokenHeader
+	if err = json.Unmarshal(headerBytes, &header); err != nil {
+		return nil, ErrMalformedToken
+	}
+	if header.Kid == "" {
+		return nil, ErrTokenKeyIDMissing
+	}
+	cert, ok := v.certs[header.Kid]
+	if !ok {
+		return nil, newJWTClientErr(ErrTokenUnknownKeyID, header.Kid)
+	}
+	if err = verifySignature(header.Alg, cert.PublicKey.(*rsa.PublicKey), signingInput, signature); err != nil {
+		return nil, err
+	}
+
+	var sc StandardClaims
+	if err = json.Unmarshal(payload, &sc); err != nil {
+		return nil, ErrMalformedToken
+	}
+	now := time.Now()
+	if sc.ExpiresAt == 0 {
+		return nil, ErrTokenExpiryMissing
+	}
+	if now.After(sc.ExpiryTime().Add(v.Leeway)) {
+		return nil, ErrTokenExpired
+	}
+	if sc.NotBefore != 0 && now.Add(v.Leeway).Before(time.Unix(sc.NotBefore, 0)) {
+		return nil, ErrTokenNotYetValid
+	}
+	if now.After(cert.NotAfter) {
+		return nil, ErrJWTSigningCertExpired
+	}
+	if v.Issuer != "" && sc.Issuer != v.Issuer {
+		return nil, newJWTClientErr(ErrTokenIssuerInvalid, sc.Issuer)
+	}
+	if claims != nil {
+		if err = json.Unmarshal(payload, claims); err != nil {
+			return nil, ErrMalformedToken
+		}
+	}
+	return &sc, nil
+}
+
+func verifySignature(alg string, pubKey *rsa.PublicKey, signingInput, signature []byte) error {
+
+	digest := sha512.Sum384(signingInput)
+	var err error
+	switch alg {
+	case "RS384":
+		err = rsa.VerifyPKCS1v15(pubKey, crypto.SHA384, digest[:], signature)
+	case "PS384":
+		err = rsa.VerifyPSS(pubKey, crypto.SHA384, digest[:], signature, &rsa.PSSOptions{
+			SaltLength: rsa.PSSSaltLengthAuto,
+		})
+	default:
+		return newJWTClientErr(ErrTokenAlgUnsupported, alg)
+	}
+	if err != nil {
+		return ErrTokenSignatureInvalid
+	}
+	return nil
+}
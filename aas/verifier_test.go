@@ -0,0 +1,183 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package aas
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	types "intel/isecl/lib/common/v5/types/aas"
+)
+
+// testPKI is a CMS root CA with an AAS JWT signing certificate issued by it
+type testPKI struct {
+	rootCA     *x509.Certificate
+	rootCAKey  *rsa.PrivateKey
+	rootCAPEM  []byte
+	signCert   *x509.Certificate
+	signKey    *rsa.PrivateKey
+	signingPEM []byte
+}
+
+func pemEncodeCert(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+func newTestCert(t *testing.T, template, parent *x509.Certificate, pub *rsa.PublicKey, parentKey *rsa.PrivateKey) *x509.Certificate {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, parentKey)
+	if err != nil {
+		t.Fatal("failed to create certificate: ", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal("failed to parse certificate: ", err)
+	}
+	return cert
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+
+	var pki testPKI
+	var err error
+	if pki.rootCAKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		t.Fatal("failed to generate key: ", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "CMSCA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	pki.rootCA = newTestCert(t, caTemplate, caTemplate, &pki.rootCAKey.PublicKey, pki.rootCAKey)
+	pki.rootCAPEM = pemEncodeCert(pki.rootCA)
+	pki.rotateSigningCert(t)
+	return &pki
+}
+
+// rotateSigningCert issues a new JWT signing certificate with a new key
+func (pki *testPKI) rotateSigningCert(t *testing.T) {
+
+	var err error
+	if pki.signKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		t.Fatal("failed to generate key: ", err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	pki.signCert = newTestCert(t, &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "AAS JWT Signing Certificate"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(12 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, pki.rootCA, &pki.signKey.PublicKey, pki.rootCAKey)
+	pki.signingPEM = pemEncodeCert(pki.signCert)
+}
+
+// signToken returns a token with claims signed by the JWT signing certificate with alg
+func (pki *testPKI) signToken(t *testing.T, alg string, claims interface{}) []byte {
+
+	enc := base64.RawURLEncoding
+	header, _ := json.Marshal(tokenHeader{Alg: alg, Kid: KeyID(pki.signCert)})
+	payload, _ := json.Marshal(claims)
+	signingInput := enc.EncodeToString(header) + "." + enc.EncodeToString(payload)
+	digest := sha512.Sum384([]byte(signingInput))
+
+	var signature []byte
+	var err error
+	switch alg {
+	case "PS384":
+		signature, err = rsa.SignPSS(rand.Reader, pki.signKey, crypto.SHA384, digest[:], nil)
+	default:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, pki.signKey, crypto.SHA384, digest[:])
+	}
+	if err != nil {
+		t.Fatal("failed to sign token: ", err)
+	}
+	return []byte(signingInput + "." + enc.EncodeToString(signature))
+}
+
+func validTestClaims() Claims {
+	return Claims{
+		StandardClaims: StandardClaims{
+			Issuer:    "AAS JWT Issuer",
+			Subject:   "admin",
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+		AuthClaims: types.AuthClaims{
+			Roles: []types.RoleInfo{{Service: "TA", Name: "Administrator"}},
+		},
+	}
+}
+
+func TestJWTVerifier(t *testing.T) {
+
+	pki := newTestPKI(t)
+	v, err := NewJWTVerifier(append(pki.signingPEM, pki.rootCAPEM...), pki.rootCAPEM)
+	assert.NoError(t, err, "verifier should be created")
+	assert.Equal(t, []string{KeyID(pki.signCert)}, v.KeyIDs(), "only the signing certificate should be used")
+	v.Issuer = "AAS JWT Issuer"
+
+	for _, alg := range []string{"RS384", "PS384"} {
+		claims, err := v.VerifyClaims(pki.signToken(t, alg, validTestClaims()))
+		assert.NoError(t, err, alg+" token should be verified")
+		assert.Equal(t, "admin", claims.Subject)
+		assert.True(t, claims.HasRole("TA", "Administrator"))
+	}
+
+	expired := validTestClaims()
+	expired.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	_, err = v.Verify(pki.signToken(t, "RS384", expired), nil)
+	assert.True(t, errors.Is(err, ErrTokenExpired), "expired token should be rejected")
+	v.Leeway = 2 * time.Minute
+	_, err = v.Verify(pki.signToken(t, "RS384", expired), nil)
+	assert.NoError(t, err, "token expired within leeway should be accepted")
+	v.Leeway = 0
+
+	noExpiry := validTestClaims()
+	noExpiry.ExpiresAt = 0
+	_, err = v.Verify(pki.signToken(t, "RS384", noExpiry), nil)
+	assert.True(t, errors.Is(err, ErrTokenExpiryMissing), "token without expiry should be rejected")
+
+	notYetValid := validTestClaims()
+	notYetValid.NotBefore = time.Now().Add(time.Minute).Unix()
+	_, err = v.Verify(pki.signToken(t, "RS384", notYetValid), nil)
+	assert.True(t, errors.Is(err, ErrTokenNotYetValid), "token not valid yet should be rejected")
+
+	otherIssuer := validTestClaims()
+	otherIssuer.Issuer = "Other Issuer"
+	_, err = v.Verify(pki.signToken(t, "RS384", otherIssuer), nil)
+	assert.True(t, errors.Is(err, ErrTokenIssuerInvalid), "token of other issuer should be rejected")
+
+	token := pki.signToken(t, "RS384", validTestClaims())
+	token[len(token)-5] ^= 'A' ^ 'B'
+	_, err = v.Verify(token, nil)
+	assert.Error(t, err, "token with modified signature should be rejected")
+
+	_, err = v.Verify(pki.signToken(t, "HS256", validTestClaims()), nil)
+	assert.True(t, errors.Is(err, ErrTokenAlgUnsupported), "token with unsupported algorithm should be rejected")
+
+	pki.rotateSigningCert(t)
+	_, err = v.Verify(pki.signToken(t, "RS384", validTestClaims()), nil)
+	assert.True(t, errors.Is(err, ErrTokenUnknownKeyID), "token of unknown signing certificate should be rejected")
+
+	other := newTestPKI(t)
+	_, err = NewJWTVerifier(pki.signingPEM, other.rootCAPEM)
+	assert.True(t, errors.Is(err, ErrNoValidJWTSigningCert), "signing certificate of other root CA should be rejected")
+}
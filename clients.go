@@ -15,16 +15,48 @@ import (
 	"strings"
 )
 
+// HTTPClientErr is the error returned when a service responds with an unexpected status.
+// RetBody holds the raw response body, RetMessage, Details and RequestID are decoded from
+// the error payload of the service.
 type HTTPClientErr struct {
 	ErrMessage string
 	RetCode    int
+	RetBody    string
 	RetMessage string
+	URL        string
+	Details    []string
+	RequestID  string
 }
 
 func (ucErr *HTTPClientErr) Error() string {
 	return fmt.Sprintf("%s: %d: %s", ucErr.ErrMessage, ucErr.RetCode, ucErr.RetMessage)
 }
 
+// Is reports whether target is an HTTPClientErr of the same operation
+func (ucErr *HTTPClientErr) Is(target error) bool {
+	t, ok := target.(*HTTPClientErr)
+	return ok && t.ErrMessage == ucErr.ErrMessage
+}
+
+// NewHTTPClientErr returns a new error for the operation described by sentinel that failed
+// with the response rsp. The error payload in the response body is decoded into the error,
+// the sentinel itself is never modified so that concurrent failures do not overwrite each other.
+func NewHTTPClientErr(sentinel *HTTPClientErr, rsp *http.Response) *HTTPClientErr {
+	msg, _ := ioutil.ReadAll(rsp.Body)
+	err := &HTTPClientErr{
+		ErrMessage: sentinel.ErrMessage,
+		RetCode:    rsp.StatusCode,
+	}
+	if rsp.Request != nil && rsp.Request.URL != nil {
+		err.URL = rsp.Request.URL.String()
+	}
+	err.decodeBody(msg)
+	if err.RequestID == "" {
+		err.RequestID = requestIDFromHeader(rsp.Header)
+	}
+	return err
+}
+
 func HTTPClient() *http.Client {
 	return &http.Client{}
 }
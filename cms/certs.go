@@ -0,0 +1,165 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package cms
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+)
+
+type CertificateErr struct {
+	ErrMessage string
+	ErrInfo    string
+}
+
+func (certErr *CertificateErr) Error() string {
+	return fmt.Sprintf("%s: %s", certErr.ErrMessage, certErr.ErrInfo)
+}
+
+// Is reports whether target is a CertificateErr with the same message
+func (certErr *CertificateErr) Is(target error) bool {
+	t, ok := target.(*CertificateErr)
+	return ok && t.ErrMessage == certErr.ErrMessage
+}
+
+// newCertificateErr returns a copy of sentinel carrying the information info
+func newCertificateErr(sentinel *CertificateErr, info string) *CertificateErr {
+	return &CertificateErr{
+		ErrMessage: sentinel.ErrMessage,
+		ErrInfo:    info,
+	}
+}
+
+var (
+	ErrCSRInvalid = &CertificateErr{
+		ErrMessage: "Invalid certificate request",
+	}
+	ErrCertificateMalformed = &CertificateErr{
+		ErrMessage: "Malformed certificate returned by CMS",
+	}
+	ErrCertificateChainInvalid = &CertificateErr{
+		ErrMessage: "Certificate does not chain to the CMS root CA",
+	}
+	ErrCertificateKeyMismatch = &CertificateErr{
+		ErrMessage: "Certificate is not issued for the public key of the request",
+	}
+)
+
+// parseCertificates returns all certificates of a PEM bundle
+func parseCertificates(pemBytes []byte) ([]*x509.Certificate, error) {
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, pemBytes = pem.Decode(pemBytes)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, newCertificateErr(ErrCertificateMalformed, err.Error())
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, newCertificateErr(ErrCertificateMalformed, "no certificate found")
+	}
+	return certs, nil
+}
+
+// parseCSR returns the certificate request of a PEM encoded or DER encoded csr
+func parseCSR(csr []byte) (*x509.CertificateRequest, error) {
+
+	der := csr
+	if block, _ := pem.Decode(csr); block != nil {
+		der = block.Bytes
+	}
+	req, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, newCertificateErr(ErrCSRInvalid, err.Error())
+	}
+	if err = req.CheckSignature(); err != nil {
+		return nil, newCertificateErr(ErrCSRInvalid, err.Error())
+	}
+	return req, nil
+}
+
+// verifyChain checks that the first certificate of chain is issued for pub and chains to one
+// of roots, with the other certificates of chain as intermediates
+func verifyChain(chain, roots []*x509.Certificate, pub crypto.PublicKey) error {
+
+	rootPool := x509.NewCertPool()
+	for _, root := range roots {
+		rootPool.AddCert(root)
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         rootPool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return newCertificateErr(ErrCertificateChainInvalid, err.Error())
+	}
+	if key, ok := pub.(interface{ Equal(crypto.PublicKey) bool }); !ok || !key.Equal(chain[0].PublicKey) {
+		return newCertificateErr(ErrCertificateKeyMismatch, chain[0].Subject.String())
+	}
+	return nil
+}
+
+// GetRootCACerts returns the root CA certificates of CMS
+func (c *Client) GetRootCACerts() ([]*x509.Certificate, error) {
+	return c.GetRootCACertsWithContext(context.Background())
+}
+
+func (c *Client) GetRootCACertsWithContext(ctx context.Context) ([]*x509.Certificate, error) {
+
+	rootPEM, err := c.GetRootCAWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return parseCertificates([]byte(rootPEM))
+}
+
+// PostCSRCerts has CMS sign csr, PEM or DER encoded, as a certificate of type certType, the
+// default type of CMS when empty. The issued certificate is verified to chain to the root CA
+// of CMS and to be issued for the public key of csr. It is returned first, followed by the
+// intermediate CA certificates returned by CMS.
+func (c *Client) PostCSRCerts(csr []byte, certType CertType) ([]*x509.Certificate, error) {
+	return c.PostCSRCertsWithContext(context.Background(), csr, certType)
+}
+
+func (c *Client) PostCSRCertsWithContext(ctx context.Context, csr []byte, certType CertType) ([]*x509.Certificate, error) {
+
+	req, err := parseCSR(csr)
+	if err != nil {
+		return nil, err
+	}
+	certPEM, err := c.PostCSRWithCertTypeWithContext(ctx, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: req.Raw}), certType)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := parseCertificates([]byte(certPEM))
+	if err != nil {
+		return nil, err
+	}
+	roots, err := c.GetRootCACertsWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = verifyChain(chain, roots, req.PublicKey); err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package cms
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostCSRCerts(t *testing.T) {
+
+	testCMS := newTestCMS(t)
+	srv := httptest.NewServer(testCMS)
+	defer srv.Close()
+	cms := Client{
+		BaseURL:    srv.URL,
+		JWTToken:   []byte("token"),
+		HTTPClient: http.DefaultClient,
+	}
+
+	roots, err := cms.GetRootCACerts()
+	assert.NoError(t, err)
+	assert.Len(t, roots, 1)
+	assert.Equal(t, "CMSCA", roots[0].Subject.CommonName)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	csr, err := createCSR(&EnrollSpec{CommonName: "Flavor Signing Certificate"}, key)
+	assert.NoError(t, err)
+	chain, err := cms.PostCSRCerts(csr, CertTypeSigning)
+	assert.NoError(t, err, "certificate should be issued")
+	assert.Len(t, chain, 2)
+	assert.Equal(t, "Flavor Signing Certificate", chain[0].Subject.CommonName)
+	assert.Equal(t, "CMS Signing CA", chain[1].Subject.CommonName)
+
+	_, err = cms.PostCSRCerts([]byte("not a csr"), CertTypeSigning)
+	assert.True(t, errors.Is(err, ErrCSRInvalid), "invalid request should be rejected before posting")
+
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	testCMS.issuedKey = &otherKey.PublicKey
+	_, err = cms.PostCSRCerts(csr, CertTypeSigning)
+	assert.True(t, errors.Is(err, ErrCertificateKeyMismatch), "certificate for another key should be rejected")
+	testCMS.issuedKey = nil
+
+	testCMS.signingCA, testCMS.signingKey = newTestCA(t, "Other CA", nil, nil)
+	_, err = cms.PostCSRCerts(csr, CertTypeSigning)
+	assert.True(t, errors.Is(err, ErrCertificateChainInvalid), "certificate of another CA should be rejected")
+
+	garbage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("no certificate"))
+	}))
+	defer garbage.Close()
+	cms.BaseURL = garbage.URL
+	_, err = cms.PostCSRCerts(csr, CertTypeSigning)
+	assert.True(t, errors.Is(err, ErrCertificateMalformed), "response without certificate should be rejected")
+}
@@ -6,49 +6,145 @@ package cms
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha512"
+	"crypto/subtle"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"errors"
 	"intel/isecl/lib/clients/v5"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 )
 
+// Client is the client of the CMS API. Requests that need authentication use the token
+// of TokenSource, or JWTToken when no TokenSource is set.
+//
+// When HTTPClient is not set, a client is created that does not verify the TLS certificate of
+// CMS against a CA, since the root CA is retrieved from CMS itself. TLSCertDigest, the hex
+// encoded SHA-384 digest of the TLS certificate of CMS, should then be set: the certificate
+// presented by CMS is pinned to it and the connection is rejected if it does not match.
+// Requests fail when both are set, since the digest could not be checked on HTTPClient.
 type Client struct {
-	BaseURL    string
-	JWTToken   []byte
-	HTTPClient *http.Client
+	BaseURL       string
+	JWTToken      []byte
+	HTTPClient    *http.Client
+	TokenSource   clients.TokenSource
+	TLSCertDigest string
+
+	// default client used when HTTPClient is not set, created on first use
+	defaultOnce   sync.Once
+	defaultClient *http.Client
+	defaultErr    error
 }
 
+// CertType selects the profile of the certificates issued by CMS
+type CertType string
+
+const (
+	// CertTypeTLS is a TLS server certificate
+	CertTypeTLS CertType = "TLS"
+	// CertTypeTLSClient is a TLS client certificate
+	CertTypeTLSClient CertType = "TLS-Client"
+	// CertTypeSigning is a signing certificate, e.g. for JWT tokens or flavors
+	CertTypeSigning CertType = "Signing"
+)
+
 var (
-	ErrFailToGetRootCA = errors.New("Failed to retrieve root CA")
-	ErrSignCSRFailed   = errors.New("Failed to sign certificate with CMS")
+	ErrFailToGetRootCA = &clients.HTTPClientErr{
+		ErrMessage: "Failed to retrieve root CA",
+	}
+	ErrSignCSRFailed = &clients.HTTPClientErr{
+		ErrMessage: "Failed to sign certificate with CMS",
+	}
+	ErrTLSCertDigestMismatch = errors.New("CMS TLS certificate does not match the expected digest")
+	ErrTLSCertDigestInvalid  = errors.New("CMS TLS certificate digest is not a hex encoded SHA-384 digest")
 )
 
-func (c *Client) httpClient() *http.Client {
-	if c.HTTPClient == nil {
-		tlsConfig := tls.Config{
-			MinVersion:         tls.VersionTLS12,
-			InsecureSkipVerify: true,
+// verifyTLSCertDigest returns a function for tls.Config.VerifyPeerCertificate accepting only
+// a peer certificate whose SHA-384 digest is digest
+func verifyTLSCertDigest(digest []byte) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return ErrTLSCertDigestMismatch
 		}
-		// Skipping verification as it is done manually using digest of the TLS certificate as this is step of setting up service
-		transport := http.Transport{
-			TLSClientConfig: &tlsConfig,
+		actual := sha512.Sum384(rawCerts[0])
+		if subtle.ConstantTimeCompare(actual[:], digest) != 1 {
+			return ErrTLSCertDigestMismatch
+		}
+		return nil
+	}
+}
+
+// httpClient returns HTTPClient, or the default client pinning the TLS certificate of CMS to
+// TLSCertDigest when set
+func (c *Client) httpClient() (*http.Client, error) {
+
+	if c.HTTPClient != nil {
+		if c.TLSCertDigest != "" {
+			return nil, errors.New("cmsClient: TLSCertDigest can not be used along with HTTPClient")
 		}
-		c.HTTPClient = &http.Client{Transport: &transport}
+		return c.HTTPClient, nil
+	}
+	c.defaultOnce.Do(func() {
+		c.defaultClient, c.defaultErr = newDefaultHTTPClient(c.TLSCertDigest)
+	})
+	return c.defaultClient, c.defaultErr
+}
+
+func newDefaultHTTPClient(tlsCertDigest string) (*http.Client, error) {
+
+	// Skipping verification against a CA as the root CA is retrieved from CMS, the certificate
+	// is pinned to the digest instead when one is given
+	tlsConfig := tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true,
+	}
+	if tlsCertDigest != "" {
+		digest, err := hex.DecodeString(strings.TrimSpace(tlsCertDigest))
+		if err != nil || len(digest) != sha512.Size384 {
+			return nil, ErrTLSCertDigestInvalid
+		}
+		tlsConfig.VerifyPeerCertificate = verifyTLSCertDigest(digest)
+	}
+	transport := http.Transport{
+		TLSClientConfig: &tlsConfig,
+	}
+	return &http.Client{Transport: &transport}, nil
+}
+
+func (c *Client) tokenSource() clients.TokenSource {
+	if c.TokenSource != nil {
+		return c.TokenSource
 	}
-	return c.HTTPClient
+	return clients.StaticTokenSource(c.JWTToken)
 }
 
 func (c *Client) GetRootCA() (string, error) {
+	return c.GetRootCAWithContext(context.Background())
+}
+
+func (c *Client) GetRootCAWithContext(ctx context.Context) (string, error) {
 
 	url := clients.ResolvePath(c.BaseURL, "cms/v1/ca-certificates")
-	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
 	req.Header.Set("Accept", "application/x-pem-file")
-	rsp, err := c.httpClient().Do(req)
+	client, err := c.httpClient()
+	if err != nil {
+		return "", err
+	}
+	rsp, err := client.Do(req)
 	if err != nil {
 		return "", err
 	}
 	if rsp.StatusCode != http.StatusOK {
-		return "", ErrFailToGetRootCA
+		return "", clients.NewHTTPClientErr(ErrFailToGetRootCA, rsp)
 	}
 	resBuf := new(bytes.Buffer)
 	resBuf.ReadFrom(rsp.Body)
@@ -56,24 +152,45 @@ func (c *Client) GetRootCA() (string, error) {
 	return resStr, nil
 }
 
+// PostCSR has CMS sign csr with the default certificate type of CMS
 func (c *Client) PostCSR(csr []byte) (string, error) {
+	return c.PostCSRWithContext(context.Background(), csr)
+}
+
+func (c *Client) PostCSRWithContext(ctx context.Context, csr []byte) (string, error) {
+	return c.PostCSRWithCertTypeWithContext(ctx, csr, "")
+}
+
+// PostCSRWithCertType has CMS sign csr as a certificate of type certType
+func (c *Client) PostCSRWithCertType(csr []byte, certType CertType) (string, error) {
+	return c.PostCSRWithCertTypeWithContext(context.Background(), csr, certType)
+}
 
-	url := clients.ResolvePath(c.BaseURL, "cms/v1/certificates")
-	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(csr))
+func (c *Client) PostCSRWithCertTypeWithContext(ctx context.Context, csr []byte, certType CertType) (string, error) {
+
+	csrURL := clients.ResolvePath(c.BaseURL, "cms/v1/certificates")
+	if certType != "" {
+		csrURL += "?" + url.Values{"certType": {string(certType)}}.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, csrURL, bytes.NewBuffer(csr))
+	if err != nil {
+		return "", err
+	}
 
 	req.Header.Set("Accept", "application/x-pem-file")
 	req.Header.Set("Content-Type", "application/x-pem-file")
 
-	req.Header.Add("Authorization", "Bearer "+string(c.JWTToken))
-	if c.HTTPClient == nil {
-		return "", errors.New("jwtClient.GetJWTSigningCert: HTTPClient should not be null")
+	client, err := c.httpClient()
+	if err != nil {
+		return "", err
 	}
-	rsp, err := c.HTTPClient.Do(req)
+	rsp, err := clients.DoWithToken(client, req, c.tokenSource())
 	if err != nil {
 		return "", err
 	}
+	defer rsp.Body.Close()
 	if rsp.StatusCode != http.StatusOK {
-		return "", ErrSignCSRFailed
+		return "", clients.NewHTTPClientErr(ErrSignCSRFailed, rsp)
 	}
 	resBuf := new(bytes.Buffer)
 	resBuf.ReadFrom(rsp.Body)
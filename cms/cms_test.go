@@ -5,10 +5,17 @@
 package cms
 
 import (
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"testing"
-	// "github.com/stretchr/testify/assert"
+
+	"github.com/stretchr/testify/assert"
+	"intel/isecl/lib/clients/v5"
 )
 
 func TestCMS(t *testing.T) {
@@ -24,3 +31,84 @@ func TestCMS(t *testing.T) {
 	cms.JWTToken = jwtToken
 
 }
+
+func TestPostCSRCertType(t *testing.T) {
+
+	var certType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/cms/v1/certificates" || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		certType = r.URL.Query().Get("certType")
+		_, _ = w.Write([]byte("certificate"))
+	}))
+	defer srv.Close()
+
+	cms := Client{
+		BaseURL:    srv.URL + "/",
+		JWTToken:   []byte("token"),
+		HTTPClient: http.DefaultClient,
+	}
+	cert, err := cms.PostCSRWithCertType([]byte("csr"), CertTypeSigning)
+	assert.NoError(t, err)
+	assert.Equal(t, "certificate", cert)
+	assert.Equal(t, "Signing", certType)
+
+	_, err = cms.PostCSRWithCertType([]byte("csr"), CertTypeTLSClient)
+	assert.NoError(t, err)
+	assert.Equal(t, "TLS-Client", certType)
+
+	_, err = cms.PostCSR([]byte("csr"))
+	assert.NoError(t, err)
+	assert.Equal(t, "", certType, "no certificate type should be sent by default")
+}
+
+func TestTLSCertDigestPinning(t *testing.T) {
+
+	testCMS := newTestCMS(t)
+	srv := httptest.NewTLSServer(testCMS)
+	defer srv.Close()
+	digest := sha512.Sum384(srv.Certificate().Raw)
+
+	cms := Client{
+		BaseURL:       srv.URL,
+		TLSCertDigest: hex.EncodeToString(digest[:]),
+	}
+	rootCA, err := cms.GetRootCA()
+	assert.NoError(t, err, "CMS with the pinned TLS certificate should be accepted")
+	assert.Equal(t, string(pemEncode(testCMS.rootCA)), rootCA)
+	_, err = cms.PostCSR([]byte("csr"))
+	assert.True(t, clients.StatusCode(err) == http.StatusBadRequest, "pinned client should be used for PostCSR")
+
+	other := sha512.Sum384([]byte("other certificate"))
+	cms = Client{
+		BaseURL:       srv.URL,
+		TLSCertDigest: hex.EncodeToString(other[:]),
+	}
+	_, err = cms.GetRootCA()
+	assert.True(t, errors.Is(err, ErrTLSCertDigestMismatch), "CMS with another TLS certificate should be rejected")
+
+	cms = Client{
+		BaseURL:       srv.URL,
+		TLSCertDigest: "not a digest",
+	}
+	_, err = cms.GetRootCA()
+	assert.True(t, errors.Is(err, ErrTLSCertDigestInvalid), "invalid digest should be rejected")
+
+	cms = Client{
+		BaseURL:       srv.URL,
+		HTTPClient:    srv.Client(),
+		TLSCertDigest: hex.EncodeToString(digest[:]),
+	}
+	_, err = cms.GetRootCA()
+	assert.Error(t, err, "digest along with HTTPClient should be rejected")
+
+	cms = Client{BaseURL: srv.URL}
+	_, err = cms.GetRootCA()
+	assert.NoError(t, err, "client without digest or HTTPClient should fall back to the default client")
+	client, err := cms.httpClient()
+	assert.NoError(t, err)
+	again, _ := cms.httpClient()
+	assert.True(t, client == again, "default client should be reused")
+}
@@ -0,0 +1,222 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package cms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// KeyType is the type of the key generated by Enroll
+type KeyType string
+
+const (
+	KeyTypeRSA3072   KeyType = "RSA-3072"
+	KeyTypeECDSAP384 KeyType = "ECDSA-P384"
+)
+
+const (
+	// KeyFileMode is the mode of the key files written by Enroll
+	KeyFileMode os.FileMode = 0600
+	// CertFileMode is the mode of the certificate files written by Enroll
+	CertFileMode os.FileMode = 0644
+)
+
+// EnrollSpec describes the certificate requested by Enroll and where it is written to
+type EnrollSpec struct {
+	CommonName string
+	// SANs are the DNS names and IP addresses of the certificate
+	SANs     []string
+	KeyType  KeyType
+	CertType CertType
+	KeyFile  string
+	CertFile string
+}
+
+// generateKey returns a new private key of type keyType, RSA-3072 when empty
+func generateKey(keyType KeyType) (crypto.Signer, error) {
+	switch keyType {
+	case "", KeyTypeRSA3072:
+		return rsa.GenerateKey(rand.Reader, 3072)
+	case KeyTypeECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	default:
+		return nil, errors.New("cms.Enroll: unsupported key type " + string(keyType))
+	}
+}
+
+// createCSR returns a PEM encoded certificate request for spec signed with key
+func createCSR(spec *EnrollSpec, key crypto.Signer) ([]byte, error) {
+
+	template := x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: spec.CommonName},
+	}
+	switch key.(type) {
+	case *ecdsa.PrivateKey:
+		template.SignatureAlgorithm = x509.ECDSAWithSHA384
+	default:
+		template.SignatureAlgorithm = x509.SHA384WithRSA
+	}
+	for _, san := range spec.SANs {
+		if ip := net.ParseIP(san); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, san)
+		}
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &template, key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
+
+// renameFile is os.Rename, replaceable by tests to simulate failures
+var renameFile = os.Rename
+
+// writeTempFile writes data to a temporary file next to path with mode perm and returns
+// its name
+func writeTempFile(path string, data []byte, perm os.FileMode) (string, error) {
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return "", err
+	}
+	if err = tmp.Chmod(perm); err == nil {
+		_, err = tmp.Write(data)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// writeKeyPair replaces keyFile and certFile with key and cert. Both are written to
+// temporary files first, so that a failed write leaves the files untouched, and renamed
+// into place only afterwards. Should renaming the certificate fail, the previous key is
+// restored, so that the files never hold a key along with the certificate of another. If
+// restoring the key fails as well, the returned error says so.
+func writeKeyPair(keyFile string, key []byte, certFile string, cert []byte) error {
+
+	keyTmp, err := writeTempFile(keyFile, key, KeyFileMode)
+	if err != nil {
+		return errors.New("failed to write key: " + err.Error())
+	}
+	defer os.Remove(keyTmp)
+	certTmp, err := writeTempFile(certFile, cert, CertFileMode)
+	if err != nil {
+		return errors.New("failed to write certificate: " + err.Error())
+	}
+	defer os.Remove(certTmp)
+
+	oldKey, err := ioutil.ReadFile(keyFile)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.New("failed to read previous key: " + err.Error())
+	}
+	if err = renameFile(keyTmp, keyFile); err != nil {
+		return errors.New("failed to write key: " + err.Error())
+	}
+	if err = renameFile(certTmp, certFile); err != nil {
+		if restoreErr := restoreKey(keyFile, oldKey); restoreErr != nil {
+			return errors.New("failed to write certificate: " + err.Error() +
+				", failed to restore previous key: " + restoreErr.Error())
+		}
+		return errors.New("failed to write certificate: " + err.Error())
+	}
+	return nil
+}
+
+// restoreKey puts oldKey back into keyFile, or removes keyFile when there was no key before
+func restoreKey(keyFile string, oldKey []byte) error {
+
+	if oldKey == nil {
+		if err := os.Remove(keyFile); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	restoreTmp, err := writeTempFile(keyFile, oldKey, KeyFileMode)
+	if err != nil {
+		return err
+	}
+	if err = renameFile(restoreTmp, keyFile); err != nil {
+		os.Remove(restoreTmp)
+		return err
+	}
+	return nil
+}
+
+// Enroll generates a key, has CMS issue a certificate for it as described by spec, verifies
+// the issued certificate chain against the root CA of CMS and writes the key and the chain
+// to spec.KeyFile and spec.CertFile. When writing either of them fails, the previous files
+// are kept. It returns the issued certificate chain.
+func (c *Client) Enroll(spec EnrollSpec) ([]*x509.Certificate, error) {
+	return c.EnrollWithContext(context.Background(), spec)
+}
+
+func (c *Client) EnrollWithContext(ctx context.Context, spec EnrollSpec) ([]*x509.Certificate, error) {
+	chain, _, err := c.enroll(ctx, &spec)
+	return chain, err
+}
+
+// enroll enrolls the certificate of spec and returns the issued chain along with the key
+// pair as written to the files
+func (c *Client) enroll(ctx context.Context, spec *EnrollSpec) ([]*x509.Certificate, *tls.Certificate, error) {
+
+	if spec.KeyFile == "" || spec.CertFile == "" {
+		return nil, nil, errors.New("cms.Enroll: key and certificate file paths are required")
+	}
+	key, err := generateKey(spec.KeyType)
+	if err != nil {
+		return nil, nil, err
+	}
+	csr, err := createCSR(spec, key)
+	if err != nil {
+		return nil, nil, errors.New("cms.Enroll: failed to create certificate request: " + err.Error())
+	}
+	chain, err := c.PostCSRCertsWithContext(ctx, csr, spec.CertType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	pair := tls.Certificate{
+		PrivateKey: key,
+		Leaf:       chain[0],
+	}
+	var chainPEM []byte
+	for _, cert := range chain {
+		pair.Certificate = append(pair.Certificate, cert.Raw)
+		chainPEM = append(chainPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	if err = writeKeyPair(spec.KeyFile, keyPEM, spec.CertFile, chainPEM); err != nil {
+		return nil, nil, errors.New("cms.Enroll: " + err.Error())
+	}
+	return chain, &pair, nil
+}
@@ -0,0 +1,241 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package cms
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testCMS is a CMS signing certificate requests with an intermediate CA chaining to its root CA
+type testCMS struct {
+	rootCA     *x509.Certificate
+	signingCA  *x509.Certificate
+	signingKey *rsa.PrivateKey
+	certType   string
+	validity   time.Duration
+	// issuedKey, when set, replaces the public key of the requests in the issued certificates
+	issuedKey interface{}
+}
+
+func newTestCA(t *testing.T, cn string, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey) {
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal("failed to generate key: ", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal("failed to create certificate: ", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+func newTestCMS(t *testing.T) *testCMS {
+	rootCA, rootKey := newTestCA(t, "CMSCA", nil, nil)
+	signingCA, signingKey := newTestCA(t, "CMS Signing CA", rootCA, rootKey)
+	return &testCMS{
+		rootCA:     rootCA,
+		signingCA:  signingCA,
+		signingKey: signingKey,
+		validity:   time.Hour,
+	}
+}
+
+func pemEncode(certs ...*x509.Certificate) []byte {
+	var pemBytes []byte
+	for _, cert := range certs {
+		pemBytes = append(pemBytes, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return pemBytes
+}
+
+func (cms *testCMS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	switch r.URL.Path {
+	case "/cms/v1/ca-certificates":
+		_, _ = w.Write(pemEncode(cms.rootCA))
+	case "/cms/v1/certificates":
+		body, _ := ioutil.ReadAll(r.Body)
+		block, _ := pem.Decode(body)
+		if block == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil || csr.CheckSignature() != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		cms.certType = r.URL.Query().Get("certType")
+		pub := csr.PublicKey
+		if cms.issuedKey != nil {
+			pub = cms.issuedKey
+		}
+		der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			Subject:      csr.Subject,
+			DNSNames:     csr.DNSNames,
+			IPAddresses:  csr.IPAddresses,
+			NotBefore:    time.Now().Add(-time.Minute),
+			NotAfter:     time.Now().Add(cms.validity),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		}, cms.signingCA, pub, cms.signingKey)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		leaf, _ := x509.ParseCertificate(der)
+		_, _ = w.Write(pemEncode(leaf, cms.signingCA))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestEnroll(t *testing.T) {
+
+	testCMS := newTestCMS(t)
+	srv := httptest.NewServer(testCMS)
+	defer srv.Close()
+	cms := Client{
+		BaseURL:    srv.URL,
+		JWTToken:   []byte("token"),
+		HTTPClient: http.DefaultClient,
+	}
+
+	dir := t.TempDir()
+	for _, keyType := range []KeyType{KeyTypeRSA3072, KeyTypeECDSAP384} {
+		spec := EnrollSpec{
+			CommonName: "Attestation Hub TLS Certificate",
+			SANs:       []string{"hub.example.com", "127.0.0.1"},
+			KeyType:    keyType,
+			CertType:   CertTypeTLS,
+			KeyFile:    filepath.Join(dir, string(keyType)+".key"),
+			CertFile:   filepath.Join(dir, string(keyType)+".pem"),
+		}
+		chain, err := cms.Enroll(spec)
+		assert.NoError(t, err, string(keyType)+" enrollment should succeed")
+		assert.Len(t, chain, 2, "issued chain should include the intermediate CA")
+		assert.Equal(t, "TLS", testCMS.certType)
+		assert.Equal(t, []string{"hub.example.com"}, chain[0].DNSNames)
+		assert.Len(t, chain[0].IPAddresses, 1)
+
+		info, err := os.Stat(spec.KeyFile)
+		assert.NoError(t, err)
+		assert.Equal(t, KeyFileMode, info.Mode().Perm(), "key file should only be accessible by the owner")
+		pair, err := tls.LoadX509KeyPair(spec.CertFile, spec.KeyFile)
+		assert.NoError(t, err, "written key and certificate should match")
+		switch keyType {
+		case KeyTypeRSA3072:
+			assert.Equal(t, 3072, pair.PrivateKey.(*rsa.PrivateKey).N.BitLen())
+		case KeyTypeECDSAP384:
+			assert.Equal(t, "P-384", pair.PrivateKey.(*ecdsa.PrivateKey).Curve.Params().Name)
+		}
+	}
+
+	testCMS.signingCA, testCMS.signingKey = newTestCA(t, "Other CA", nil, nil)
+	spec := EnrollSpec{
+		CommonName: "rejected",
+		KeyType:    KeyTypeECDSAP384,
+		KeyFile:    filepath.Join(dir, "rejected.key"),
+		CertFile:   filepath.Join(dir, "rejected.pem"),
+	}
+	_, err := cms.Enroll(spec)
+	assert.Error(t, err, "certificate not chaining to the root CA should be rejected")
+	_, err = os.Stat(spec.KeyFile)
+	assert.True(t, os.IsNotExist(err), "no files should be written for a rejected certificate")
+}
+
+func TestEnrollKeepsKeyPairOnFailedWrite(t *testing.T) {
+
+	testCMS := newTestCMS(t)
+	srv := httptest.NewServer(testCMS)
+	defer srv.Close()
+	cms := Client{
+		BaseURL:    srv.URL,
+		JWTToken:   []byte("token"),
+		HTTPClient: http.DefaultClient,
+	}
+	dir := t.TempDir()
+	spec := EnrollSpec{
+		CommonName: "TLS Certificate",
+		KeyType:    KeyTypeECDSAP384,
+		KeyFile:    filepath.Join(dir, "tls.key"),
+		CertFile:   filepath.Join(dir, "tls.cert"),
+	}
+	_, err := cms.Enroll(spec)
+	assert.NoError(t, err)
+	key, _ := ioutil.ReadFile(spec.KeyFile)
+
+	renameFile = func(from, to string) error {
+		if to == spec.CertFile {
+			return os.ErrPermission
+		}
+		return os.Rename(from, to)
+	}
+	defer func() { renameFile = os.Rename }()
+	_, err = cms.Enroll(spec)
+	assert.Error(t, err, "failed certificate write should be reported")
+	restored, _ := ioutil.ReadFile(spec.KeyFile)
+	assert.Equal(t, key, restored, "previous key should be restored")
+	_, err = tls.LoadX509KeyPair(spec.CertFile, spec.KeyFile)
+	assert.NoError(t, err, "key and certificate should still match")
+
+	spec.CertFile = filepath.Join(dir, "missing", "tls.cert")
+	_, err = cms.Enroll(spec)
+	assert.Error(t, err)
+	unchanged, _ := ioutil.ReadFile(spec.KeyFile)
+	assert.Equal(t, key, unchanged, "key should not be replaced when the certificate can not be written")
+	files, _ := filepath.Glob(filepath.Join(dir, "*.tmp*"))
+	assert.Empty(t, files, "temporary files should be removed")
+
+	spec.CertFile = filepath.Join(dir, "tls.cert")
+	keyRenames := 0
+	renameFile = func(from, to string) error {
+		if to == spec.KeyFile {
+			keyRenames++
+			if keyRenames > 1 {
+				return os.ErrPermission
+			}
+		}
+		if to == spec.CertFile {
+			return os.ErrPermission
+		}
+		return os.Rename(from, to)
+	}
+	_, err = cms.Enroll(spec)
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "failed to restore previous key"), "failed restore should be reported: %v", err)
+}
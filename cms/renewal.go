@@ -0,0 +1,175 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package cms
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRenewAt is the RenewAt used when none is set
+	DefaultRenewAt = 2.0 / 3
+	// DefaultRenewRetryInterval is the RetryInterval used when none is set
+	DefaultRenewRetryInterval = time.Minute
+)
+
+// RenewalManager keeps the certificate enrolled with Spec up to date. The certificate is
+// enrolled again once RenewAt, a fraction of its lifetime, has passed, and the new key and
+// certificate replace the files of Spec as a pair: when writing them fails, the previous
+// files and the current certificate are kept. Failed renewals are retried every
+// RetryInterval.
+//
+// GetCertificate and GetClientCertificate can be set as the callbacks of tls.Config, so that
+// running servers and clients pick up renewed certificates without restart. OnRenew, when
+// set, is called with every renewed certificate, OnError with every failed renewal.
+type RenewalManager struct {
+	Client        *Client
+	Spec          EnrollSpec
+	RenewAt       float64
+	RetryInterval time.Duration
+	OnRenew       func(cert *tls.Certificate)
+	OnError       func(err error)
+
+	renewMu sync.Mutex
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+}
+
+// NewRenewalManager returns a renewal manager for the certificate of spec. The key and
+// certificate files of spec are used if they hold a valid certificate, otherwise a
+// certificate is enrolled right away.
+func NewRenewalManager(c *Client, spec EnrollSpec) (*RenewalManager, error) {
+
+	m := RenewalManager{
+		Client: c,
+		Spec:   spec,
+	}
+	cert, err := loadCertificate(spec.CertFile, spec.KeyFile)
+	if err == nil && time.Now().Before(cert.Leaf.NotAfter) {
+		m.cert = cert
+		return &m, nil
+	}
+	if err = m.Renew(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// loadCertificate returns the key pair of the files certFile and keyFile
+func loadCertificate(certFile, keyFile string) (*tls.Certificate, error) {
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+func (m *RenewalManager) renewAt() float64 {
+	if m.RenewAt <= 0 || m.RenewAt > 1 {
+		return DefaultRenewAt
+	}
+	return m.RenewAt
+}
+
+func (m *RenewalManager) retryInterval() time.Duration {
+	if m.RetryInterval == 0 {
+		return DefaultRenewRetryInterval
+	}
+	return m.RetryInterval
+}
+
+// Certificate returns the current certificate
+func (m *RenewalManager) Certificate() *tls.Certificate {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.cert
+}
+
+// GetCertificate returns the current certificate, for tls.Config.GetCertificate
+func (m *RenewalManager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return m.Certificate(), nil
+}
+
+// GetClientCertificate returns the current certificate, for tls.Config.GetClientCertificate
+func (m *RenewalManager) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return m.Certificate(), nil
+}
+
+// RenewTime returns the time the current certificate is due for renewal, or the zero time
+// when no certificate is loaded yet so that it is enrolled at once
+func (m *RenewalManager) RenewTime() time.Time {
+	cert := m.Certificate()
+	if cert == nil || cert.Leaf == nil {
+		return time.Time{}
+	}
+	leaf := cert.Leaf
+	lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+	return leaf.NotBefore.Add(time.Duration(float64(lifetime) * m.renewAt()))
+}
+
+// Renew enrolls the certificate again and makes it the current certificate
+func (m *RenewalManager) Renew() error {
+	return m.RenewWithContext(context.Background())
+}
+
+func (m *RenewalManager) RenewWithContext(ctx context.Context) error {
+
+	if m.Client == nil {
+		return errors.New("cms.RenewalManager: Client should not be null")
+	}
+	m.renewMu.Lock()
+	defer m.renewMu.Unlock()
+	_, cert, err := m.Client.enroll(ctx, &m.Spec)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.cert = cert
+	m.mu.Unlock()
+	if m.OnRenew != nil {
+		m.OnRenew(cert)
+	}
+	return nil
+}
+
+// Start renews the certificate in the background when it is due, until ctx is done
+func (m *RenewalManager) Start(ctx context.Context) {
+	go func() {
+		wait := time.Until(m.RenewTime())
+		for {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			if err := m.RenewWithContext(ctx); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				if m.OnError != nil {
+					m.OnError(err)
+				}
+				wait = m.retryInterval()
+				continue
+			}
+			// certificates issued with a short lifetime are not renewed more often than retried
+			wait = time.Until(m.RenewTime())
+			if wait < m.retryInterval() {
+				wait = m.retryInterval()
+			}
+		}
+	}()
+}
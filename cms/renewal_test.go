@@ -0,0 +1,158 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package cms
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenewalManager(t *testing.T) {
+
+	testCMS := newTestCMS(t)
+	srv := httptest.NewServer(testCMS)
+	defer srv.Close()
+	cms := &Client{
+		BaseURL:    srv.URL,
+		JWTToken:   []byte("token"),
+		HTTPClient: http.DefaultClient,
+	}
+	dir := t.TempDir()
+	spec := EnrollSpec{
+		CommonName: "Workload Service TLS Certificate",
+		SANs:       []string{"localhost"},
+		KeyType:    KeyTypeECDSAP384,
+		CertType:   CertTypeTLS,
+		KeyFile:    filepath.Join(dir, "tls.key"),
+		CertFile:   filepath.Join(dir, "tls.cert"),
+	}
+
+	m, err := NewRenewalManager(cms, spec)
+	assert.NoError(t, err, "certificate should be enrolled")
+	first := m.Certificate()
+	assert.Equal(t, first.Leaf.NotBefore.Add(time.Duration(float64(first.Leaf.NotAfter.Sub(first.Leaf.NotBefore))*DefaultRenewAt)), m.RenewTime())
+
+	reloaded, err := NewRenewalManager(cms, spec)
+	assert.NoError(t, err)
+	assert.Equal(t, first.Leaf.SerialNumber, reloaded.Certificate().Leaf.SerialNumber, "enrolled certificate should be reused")
+
+	renewed := make(chan *tls.Certificate, 10)
+	m.RenewAt = 0.01
+	m.RetryInterval = 50 * time.Millisecond
+	m.OnRenew = func(cert *tls.Certificate) {
+		renewed <- cert
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m.Start(ctx)
+
+	var cert *tls.Certificate
+	select {
+	case cert = <-renewed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("certificate should be renewed")
+	}
+	cancel()
+	// keep a renewal in progress from replacing the certificate while it is checked
+	m.renewMu.Lock()
+	defer m.renewMu.Unlock()
+	assert.NotEqual(t, first.Leaf.SerialNumber, cert.Leaf.SerialNumber)
+
+	current, err := m.GetCertificate(nil)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.Leaf.SerialNumber, current.Leaf.SerialNumber, "renewed certificate should be served")
+	onDisk, err := loadCertificate(spec.CertFile, spec.KeyFile)
+	assert.NoError(t, err, "renewed key and certificate should be written")
+	assert.Equal(t, current.Leaf.SerialNumber, onDisk.Leaf.SerialNumber)
+
+	clientCert, err := m.GetClientCertificate(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, current, clientCert)
+}
+
+func TestRenewalManagerWithoutCertificate(t *testing.T) {
+
+	testCMS := newTestCMS(t)
+	srv := httptest.NewServer(testCMS)
+	defer srv.Close()
+	dir := t.TempDir()
+	renewed := make(chan *tls.Certificate, 1)
+	m := &RenewalManager{
+		Client: &Client{
+			BaseURL:    srv.URL,
+			JWTToken:   []byte("token"),
+			HTTPClient: http.DefaultClient,
+		},
+		Spec: EnrollSpec{
+			CommonName: "Workload Service TLS Certificate",
+			KeyFile:    filepath.Join(dir, "tls.key"),
+			CertFile:   filepath.Join(dir, "tls.cert"),
+		},
+		OnRenew: func(cert *tls.Certificate) {
+			renewed <- cert
+		},
+	}
+	assert.True(t, m.RenewTime().IsZero(), "manager without certificate should be due for renewal")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m.Start(ctx)
+	select {
+	case cert := <-renewed:
+		assert.NotNil(t, cert.Leaf)
+	case <-time.After(5 * time.Second):
+		t.Fatal("certificate should be enrolled at once")
+	}
+}
+
+func TestRenewalManagerFailedWrite(t *testing.T) {
+
+	testCMS := newTestCMS(t)
+	srv := httptest.NewServer(testCMS)
+	defer srv.Close()
+	cms := &Client{
+		BaseURL:    srv.URL,
+		JWTToken:   []byte("token"),
+		HTTPClient: http.DefaultClient,
+	}
+	dir := t.TempDir()
+	spec := EnrollSpec{
+		CommonName: "Workload Service TLS Certificate",
+		KeyType:    KeyTypeECDSAP384,
+		KeyFile:    filepath.Join(dir, "tls.key"),
+		CertFile:   filepath.Join(dir, "tls.cert"),
+	}
+	m, err := NewRenewalManager(cms, spec)
+	assert.NoError(t, err)
+	first := m.Certificate()
+
+	renameFile = func(from, to string) error {
+		if to == spec.CertFile {
+			return os.ErrPermission
+		}
+		return os.Rename(from, to)
+	}
+	defer func() { renameFile = os.Rename }()
+	assert.Error(t, m.Renew(), "failed certificate write should be reported")
+	assert.Equal(t, first, m.Certificate(), "current certificate should be kept")
+	onDisk, err := loadCertificate(spec.CertFile, spec.KeyFile)
+	assert.NoError(t, err, "key and certificate files should still match")
+	assert.Equal(t, first.Leaf.SerialNumber, onDisk.Leaf.SerialNumber)
+
+	renameFile = os.Rename
+	assert.NoError(t, m.Renew())
+	onDisk, err = loadCertificate(spec.CertFile, spec.KeyFile)
+	assert.NoError(t, err)
+	assert.Equal(t, m.Certificate().Leaf.SerialNumber, onDisk.Leaf.SerialNumber)
+	assert.NotEqual(t, first.Leaf.SerialNumber, onDisk.Leaf.SerialNumber)
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package clients
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	// keys under which the services report the error message, details and request ID
+	// in JSON error payloads
+	errMessageKeys   = []string{"message", "Message", "error", "error_message", "errorMessage"}
+	errDetailsKeys   = []string{"details", "Details", "errors", "validation_errors"}
+	errRequestIDKeys = []string{"request_id", "requestId", "RequestID"}
+
+	requestIDHeaders = []string{"X-Request-Id", "Request-Id", "X-Correlation-Id"}
+)
+
+// decodeBody keeps the raw error payload of a service in RetBody and fills RetMessage, Details
+// and RequestID from it. The payload is either a JSON object or plain text, plain text is used
+// as the message as is.
+func (ucErr *HTTPClientErr) decodeBody(body []byte) {
+
+	ucErr.RetBody = string(body)
+	text := strings.TrimSpace(ucErr.RetBody)
+	ucErr.RetMessage = text
+
+	var payload map[string]interface{}
+	if !strings.HasPrefix(text, "{") || json.Unmarshal(body, &payload) != nil {
+		return
+	}
+	if msg, ok := lookupString(payload, errMessageKeys); ok {
+		ucErr.RetMessage = msg
+	}
+	if id, ok := lookupString(payload, errRequestIDKeys); ok {
+		ucErr.RequestID = id
+	}
+	for _, key := range errDetailsKeys {
+		if v, ok := payload[key]; ok {
+			ucErr.Details = detailsOf(v)
+			break
+		}
+	}
+}
+
+func lookupString(payload map[string]interface{}, keys []string) (string, bool) {
+	for _, key := range keys {
+		if s, ok := payload[key].(string); ok && s != "" {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// detailsOf flattens the details of an error payload, which are either a single value,
+// a list of values or a map of field names to values, into a list of strings
+func detailsOf(v interface{}) []string {
+	switch d := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{d}
+	case []interface{}:
+		var details []string
+		for _, item := range d {
+			details = append(details, detailsOf(item)...)
+		}
+		return details
+	case map[string]interface{}:
+		if msg, ok := lookupString(d, errMessageKeys); ok {
+			if field, ok := lookupString(d, []string{"field", "Field", "name"}); ok {
+				return []string{field + ": " + msg}
+			}
+			return []string{msg}
+		}
+		var details []string
+		for field, item := range d {
+			for _, detail := range detailsOf(item) {
+				details = append(details, field+": "+detail)
+			}
+		}
+		return details
+	default:
+		return []string{fmt.Sprint(d)}
+	}
+}
+
+func requestIDFromHeader(header http.Header) string {
+	for _, name := range requestIDHeaders {
+		if id := header.Get(name); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// StatusCode returns the HTTP status code carried by err, or 0 if err is not an HTTPClientErr
+func StatusCode(err error) int {
+	var httpErr *HTTPClientErr
+	if errors.As(err, &httpErr) {
+		return httpErr.RetCode
+	}
+	return 0
+}
+
+// IsNotFound reports whether err is the response of a service to a missing resource
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
+
+// IsConflict reports whether err is the response of a service to a resource that already exists
+func IsConflict(err error) bool {
+	return StatusCode(err) == http.StatusConflict
+}
+
+// IsUnauthorized reports whether err is the response of a service to a missing, invalid or
+// expired token
+func IsUnauthorized(err error) bool {
+	return StatusCode(err) == http.StatusUnauthorized
+}
+
+// IsForbidden reports whether err is the response of a service to a token lacking the
+// required permissions
+func IsForbidden(err error) bool {
+	return StatusCode(err) == http.StatusForbidden
+}
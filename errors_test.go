@@ -0,0 +1,62 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package clients
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errTestOperation = &HTTPClientErr{ErrMessage: "Failed to run test operation"}
+
+func testResponse(code int, body string, header http.Header) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://aas.example.com:8444/aas/v1/roles", nil)
+	return &http.Response{
+		StatusCode: code,
+		Header:     header,
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}
+}
+
+func TestNewHTTPClientErr(t *testing.T) {
+
+	err := NewHTTPClientErr(errTestOperation, testResponse(http.StatusConflict, "same role exists\n", nil))
+	assert.Equal(t, "same role exists", err.RetMessage)
+	assert.Equal(t, "same role exists\n", err.RetBody)
+	assert.Equal(t, "https://aas.example.com:8444/aas/v1/roles", err.URL)
+	assert.True(t, IsConflict(err))
+	assert.False(t, IsNotFound(err))
+	assert.True(t, errors.Is(err, errTestOperation))
+	assert.Zero(t, errTestOperation.RetCode)
+
+	body := `{"message": "Invalid input", "details": [{"field": "name", "message": "too long"}, "service is empty"], "request_id": "42"}`
+	err = NewHTTPClientErr(errTestOperation, testResponse(http.StatusBadRequest, body, nil))
+	assert.Equal(t, "Invalid input", err.RetMessage)
+	assert.Equal(t, body, err.RetBody, "raw body should be kept")
+	assert.Equal(t, []string{"name: too long", "service is empty"}, err.Details)
+	assert.Equal(t, "42", err.RequestID)
+
+	header := http.Header{}
+	header.Set("X-Request-Id", "7")
+	err = NewHTTPClientErr(errTestOperation, testResponse(http.StatusUnauthorized, `{"error": "token expired"}`, header))
+	assert.Equal(t, "token expired", err.RetMessage)
+	assert.Equal(t, "7", err.RequestID)
+	assert.True(t, IsUnauthorized(fmt.Errorf("fetching roles: %w", err)), "wrapped error should be recognized")
+
+	err = NewHTTPClientErr(errTestOperation, testResponse(http.StatusForbidden, "", nil))
+	assert.True(t, IsForbidden(err))
+	assert.Equal(t, "Failed to run test operation: 403: ", err.Error())
+	assert.False(t, IsForbidden(errors.New("Failed to run test operation")))
+}
@@ -1,11 +1,26 @@
 module intel/isecl/lib/clients/v5
 
+go 1.27.1
+
 require (
 	github.com/google/uuid v1.1.2
-	github.com/gorilla/mux v1.7.3
-	github.com/sirupsen/logrus v1.4.0
+	github.com/gorilla/mux v1.7.4
+	github.com/sirupsen/logrus v1.7.0
 	github.com/stretchr/testify v1.2.2
+	gopkg.in/yaml.v3 v3.0.1
 	intel/isecl/lib/common/v5 v5.1.0
 )
 
+require (
+	github.com/Waterdrips/jwt-go v3.2.1-0.20200915121943-f6506928b72e+incompatible // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/konsorten/go-windows-terminal-sequences v1.0.1 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/stretchr/objx v0.1.1 // indirect
+	golang.org/x/crypto v0.0.0-20180904163835-0709b304e793 // indirect
+	golang.org/x/sys v0.0.0-20191026070338-33540a1f6037 // indirect
+	gopkg.in/check.v1 v0.0.0-20161208181325-20d25e280405 // indirect
+)
+
 replace intel/isecl/lib/common/v5 => github.com/intel-secl/common/v5 v5.1.0
@@ -0,0 +1,94 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package clients
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+)
+
+// TokenSource supplies the bearer token the clients authenticate their requests with.
+// It is consulted for every request, so that long running processes pick up renewed tokens.
+type TokenSource interface {
+	// Token returns the token to send with the next request
+	Token() ([]byte, error)
+	// Refresh is called after a service rejected the token with 401 Unauthorized. It
+	// returns a new token the request is retried with once.
+	Refresh() ([]byte, error)
+}
+
+var ErrTokenNotRefreshable = errors.New("Token source can not refresh the token")
+
+type staticTokenSource []byte
+
+// StaticTokenSource returns a TokenSource that always supplies token and can not refresh it
+func StaticTokenSource(token []byte) TokenSource {
+	return staticTokenSource(token)
+}
+
+func (s staticTokenSource) Token() ([]byte, error) {
+	return s, nil
+}
+
+func (s staticTokenSource) Refresh() ([]byte, error) {
+	return nil, ErrTokenNotRefreshable
+}
+
+type fileTokenSource string
+
+// FileTokenSource returns a TokenSource that reads the token from the file path on every
+// request, so that a token rotated by another process is picked up without a restart
+func FileTokenSource(path string) TokenSource {
+	return fileTokenSource(path)
+}
+
+func (s fileTokenSource) Token() ([]byte, error) {
+	token, err := ioutil.ReadFile(string(s))
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(token), nil
+}
+
+func (s fileTokenSource) Refresh() ([]byte, error) {
+	return s.Token()
+}
+
+// DoWithToken sends req authenticated with the token of ts. When the service responds
+// with 401 Unauthorized, the token is refreshed and the request is retried once. If the
+// token can not be refreshed, the 401 response is returned to the caller.
+func DoWithToken(client *http.Client, req *http.Request, ts TokenSource) (*http.Response, error) {
+
+	token, err := ts.Token()
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+string(token))
+	rsp, err := client.Do(req)
+	if err != nil || rsp.StatusCode != http.StatusUnauthorized {
+		return rsp, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		// the body has been consumed and can not be sent again
+		return rsp, nil
+	}
+	newToken, err := ts.Refresh()
+	if err != nil || bytes.Equal(newToken, token) {
+		return rsp, nil
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		retry.Body, err = req.GetBody()
+		if err != nil {
+			return rsp, nil
+		}
+	}
+	rsp.Body.Close()
+	retry.Header.Set("Authorization", "Bearer "+string(newToken))
+	return client.Do(retry)
+}
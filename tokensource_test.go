@@ -0,0 +1,69 @@
+/*
+ * Copyright (C) 2019 Intel Corporation
+ * SPDX-License-Identifier: BSD-3-Clause
+ */
+package clients
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countingTokenSource struct {
+	token     string
+	refreshed string
+	refreshes int
+}
+
+func (s *countingTokenSource) Token() ([]byte, error) {
+	return []byte(s.token), nil
+}
+
+func (s *countingTokenSource) Refresh() ([]byte, error) {
+	s.refreshes++
+	s.token = s.refreshed
+	return []byte(s.token), nil
+}
+
+func TestDoWithToken(t *testing.T) {
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get("Authorization") != "Bearer valid" || string(body) != "payload" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	ts := &countingTokenSource{token: "expired", refreshed: "valid"}
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, bytes.NewBufferString("payload"))
+	rsp, err := DoWithToken(srv.Client(), req, ts)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rsp.StatusCode, "request should be retried with the refreshed token")
+	assert.Equal(t, 1, ts.refreshes)
+
+	req, _ = http.NewRequest(http.MethodPost, srv.URL, bytes.NewBufferString("payload"))
+	rsp, err = DoWithToken(srv.Client(), req, StaticTokenSource([]byte("expired")))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, rsp.StatusCode, "static token should not be retried")
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, ioutil.WriteFile(tokenFile, []byte("valid\n"), 0600))
+	req, _ = http.NewRequest(http.MethodPost, srv.URL, bytes.NewBufferString("payload"))
+	rsp, err = DoWithToken(srv.Client(), req, FileTokenSource(tokenFile))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rsp.StatusCode, "token should be read from file")
+
+	assert.NoError(t, os.Remove(tokenFile))
+	_, err = FileTokenSource(tokenFile).Token()
+	assert.Error(t, err, "missing token file should be reported")
+}